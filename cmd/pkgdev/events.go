@@ -0,0 +1,36 @@
+package pkgdev
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/machbase/neo-pkgdev/pkgs"
+	"github.com/spf13/cobra"
+)
+
+// addEventsFlag adds the '--events' flag to the command.
+func addEventsFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("events", "", "`[json]` print newline-delimited JSON events instead of the text")
+}
+
+// eventWriter returns the writer of the '--events' flag, or nil if the flag is not set.
+func eventWriter(cmd *cobra.Command) (*pkgs.JSONEventWriter, error) {
+	mode, _ := cmd.Flags().GetString("events")
+	switch mode {
+	case "":
+		return nil, nil
+	case "json":
+		return pkgs.NewJSONEventWriter(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unsupported events format %q", mode)
+	}
+}
+
+// emitResult emits the finished event of the operation, or the error event if err is not nil.
+func emitResult(ev *pkgs.JSONEventWriter, op string, pkgName string, result any, err error) {
+	if err != nil {
+		ev.OnEvent(&pkgs.Event{Type: pkgs.EVENT_ERROR, Op: op, PkgName: pkgName, Error: err.Error()})
+	} else {
+		ev.OnEvent(&pkgs.Event{Type: pkgs.EVENT_FINISHED, Op: op, PkgName: pkgName, Result: result})
+	}
+}
@@ -1,12 +1,14 @@
 package pkgdev
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,6 +17,16 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// ExitError is returned by a command which wants the process to exit with the Code.
+// The command has already printed its result, so main() exits without printing the error.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
 func NewCmd() *cobra.Command {
 	cobra.EnableCommandSorting = false
 
@@ -40,6 +52,7 @@ func NewCmd() *cobra.Command {
 	searchCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
 	searchCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
 	searchCmd.MarkPersistentFlagRequired("dir")
+	addEventsFlag(searchCmd)
 
 	updateCmd := &cobra.Command{
 		Use:   "update [flags]",
@@ -49,6 +62,7 @@ func NewCmd() *cobra.Command {
 	updateCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
 	updateCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
 	updateCmd.MarkPersistentFlagRequired("dir")
+	addEventsFlag(updateCmd)
 
 	installCmd := &cobra.Command{
 		Use:   "install [flags] <package name, ...>",
@@ -59,16 +73,166 @@ func NewCmd() *cobra.Command {
 	installCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
 	installCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
 	installCmd.MarkPersistentFlagRequired("dir")
+	addEventsFlag(installCmd)
+	installCmd.PersistentFlags().Int("parallel", 4, "`<N>` number of packages to download in parallel")
+	installCmd.PersistentFlags().String("file", "", "`<Archive>` install the package from the local archive file instead of downloading")
+	installCmd.PersistentFlags().String("checksum", "", "`<Digest>` expected sha256 checksum of the archive (hex or base64)")
+	installCmd.PersistentFlags().Bool("force", false, "install the held packages even if their holds do not allow the version")
+
+	upgradeCmd := &cobra.Command{
+		Use:   "upgrade [flags] <package name, ...|--all>",
+		Short: "Upgrade installed packages to the latest versions",
+		Long: "Update the rosters and upgrade the given packages, or all upgradable packages with --all.\n" +
+			"The packages held by 'hold' are not upgraded beyond their holds.\n" +
+			"It exits with 0 if all upgrades succeed, otherwise non-zero.",
+		RunE: doUpgrade,
+	}
+	upgradeCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
+	upgradeCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
+	upgradeCmd.MarkPersistentFlagRequired("dir")
+	addEventsFlag(upgradeCmd)
+	upgradeCmd.PersistentFlags().Bool("all", false, "upgrade all upgradable packages")
+	upgradeCmd.PersistentFlags().Int("parallel", 4, "`<N>` number of packages to download in parallel")
+
+	holdCmd := &cobra.Command{
+		Use:   "hold [flags] [package name] [constraint]",
+		Short: "Hold a package at the installed version, or within the constraint e.g. '~1.4'",
+		Long: "Hold a package at the installed version, or within the constraint e.g. '~1.4'.\n" +
+			"The held packages are not upgraded by 'upgrade --all', it lists the held packages if no package is given.",
+		RunE: doHold,
+	}
+	holdCmd.Args = cobra.MaximumNArgs(2)
+	holdCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
+	holdCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
+	holdCmd.MarkPersistentFlagRequired("dir")
+
+	unholdCmd := &cobra.Command{
+		Use:   "unhold [flags] <package name>",
+		Short: "Release a held package",
+		RunE:  doUnhold,
+	}
+	unholdCmd.Args = cobra.ExactArgs(1)
+	unholdCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
+	unholdCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
+	unholdCmd.MarkPersistentFlagRequired("dir")
 
 	uninstallCmd := &cobra.Command{
-		Use:   "uninstall [flags] <package name>",
+		Use:   "uninstall [flags] <package name>[@version]",
 		Short: "Uninstall a package",
-		RunE:  doUninstall,
+		Long: "Uninstall a package, or a version of it which is retained in the package directory.\n" +
+			"The data and config dirs of the package are kept unless --purge is given.",
+		RunE: doUninstall,
 	}
 	uninstallCmd.Args = cobra.ExactArgs(1)
 	uninstallCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
 	uninstallCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
 	uninstallCmd.MarkPersistentFlagRequired("dir")
+	addEventsFlag(uninstallCmd)
+	uninstallCmd.PersistentFlags().Bool("purge", false, "remove everything of the package including the data and config dirs")
+	uninstallCmd.PersistentFlags().Bool("dry-run", false, "print the paths to remove without removing them")
+	uninstallCmd.PersistentFlags().Bool("force", false, "uninstall even if the other installed packages depend on it")
+	uninstallCmd.PersistentFlags().Bool("cascade", false, "uninstall the installed packages which depend on it first")
+
+	rdependsCmd := &cobra.Command{
+		Use:   "rdepends [flags] <package name>",
+		Short: "Show the installed packages which depend on a package",
+		RunE:  doRdepends,
+	}
+	rdependsCmd.Args = cobra.ExactArgs(1)
+	rdependsCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
+	rdependsCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
+	rdependsCmd.MarkPersistentFlagRequired("dir")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify [flags] [package name, ...]",
+		Short: "Verify installed packages with their manifests",
+		Long: "Verify installed packages with their manifests, all installed packages if no package is given.\n" +
+			"It exits with 0 if all packages are intact, 1 if any file is modified, missing or unexpected, 2 on errors.",
+		RunE: doVerify,
+	}
+	verifyCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
+	verifyCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
+	verifyCmd.MarkPersistentFlagRequired("dir")
+
+	doctorCmd := &cobra.Command{
+		Use:   "doctor [flags]",
+		Short: "Diagnose and repair broken installations",
+		RunE:  doDoctor,
+	}
+	doctorCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
+	doctorCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
+	doctorCmd.MarkPersistentFlagRequired("dir")
+	doctorCmd.PersistentFlags().Bool("fix", false, "repair the problems found")
+
+	historyCmd := &cobra.Command{
+		Use:   "history [flags] [package name]",
+		Short: "Show install and uninstall history",
+		RunE:  doHistory,
+	}
+	historyCmd.Args = cobra.MaximumNArgs(1)
+	historyCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
+	historyCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
+	historyCmd.MarkPersistentFlagRequired("dir")
+
+	logsCmd := &cobra.Command{
+		Use:   "logs [flags] <package name>",
+		Short: "Show the script logs of a package",
+		RunE:  doLogs,
+	}
+	logsCmd.Args = cobra.ExactArgs(1)
+	logsCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
+	logsCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
+	logsCmd.MarkPersistentFlagRequired("dir")
+	logsCmd.PersistentFlags().Bool("list", false, "list the log files instead of printing the latest one")
+
+	cacheCmd := &cobra.Command{
+		Use:   "cache [command]",
+		Short: "Manage the downloaded archives shared by the base directories",
+	}
+	cacheCmd.PersistentFlags().String("cache-dir", "", "`<Dir>` path to the archive store, default is $NEOPKG_CACHE_DIR or 'neopkg' in the user cache dir")
+	cacheLsCmd := &cobra.Command{
+		Use:   "ls [flags]",
+		Short: "List the archives, the most recently used first",
+		RunE:  doCacheLs,
+	}
+	cacheLsCmd.Args = cobra.NoArgs
+	cacheCleanCmd := &cobra.Command{
+		Use:   "clean [flags]",
+		Short: "Remove the least recently used archives",
+		RunE:  doCacheClean,
+	}
+	cacheCleanCmd.Args = cobra.NoArgs
+	cacheCleanCmd.PersistentFlags().Int64("max-size", 0, "`<MB>` keep the recently used archives up to this size, 0 removes all")
+	cacheCmd.AddCommand(cacheLsCmd, cacheCleanCmd)
+
+	rosterCmd := &cobra.Command{
+		Use:   "roster [command]",
+		Short: "Manage the rosters of the packages other than the central roster",
+		Long: "Manage the rosters of the packages other than the central roster.\n" +
+			"The packages of the roster are named '<roster>/<package>', e.g. 'install labs/mytool'.",
+	}
+	rosterCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
+	rosterCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
+	rosterCmd.MarkPersistentFlagRequired("dir")
+	rosterAddCmd := &cobra.Command{
+		Use:   "add [flags] <roster name> <git repository url>",
+		Short: "Add a roster and fetch its packages",
+		RunE:  doRosterAdd,
+	}
+	rosterAddCmd.Args = cobra.ExactArgs(2)
+	rosterRmCmd := &cobra.Command{
+		Use:   "rm [flags] <roster name>",
+		Short: "Remove a roster which has no installed packages",
+		RunE:  doRosterRm,
+	}
+	rosterRmCmd.Args = cobra.ExactArgs(1)
+	rosterLsCmd := &cobra.Command{
+		Use:   "ls [flags]",
+		Short: "List the rosters",
+		RunE:  doRosterLs,
+	}
+	rosterLsCmd.Args = cobra.NoArgs
+	rosterCmd.AddCommand(rosterAddCmd, rosterRmCmd, rosterLsCmd)
 
 	auditCmd := &cobra.Command{
 		Use:   "audit [flags] <path to package.yml>",
@@ -109,11 +273,22 @@ func NewCmd() *cobra.Command {
 	rebuildCacheCmd.PersistentFlags().String("log-level", "none", "`[debug,info,warn,error,none]` log level, default is none")
 	rebuildCacheCmd.PersistentFlags().StringP("dir", "d", "", "`<BaseDir>` path to the package base directory")
 	rebuildCacheCmd.MarkPersistentFlagRequired("dir")
+	addEventsFlag(rebuildCacheCmd)
 
 	rootCmd.AddCommand(
 		updateCmd,
 		installCmd,
+		upgradeCmd,
+		holdCmd,
+		unholdCmd,
 		uninstallCmd,
+		rdependsCmd,
+		verifyCmd,
+		doctorCmd,
+		historyCmd,
+		logsCmd,
+		cacheCmd,
+		rosterCmd,
 		searchCmd,
 		auditCmd,
 		planCmd,
@@ -134,8 +309,22 @@ func doSearch(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	ev, err := eventWriter(cmd)
+	if err != nil {
+		return err
+	}
 	name := args[0]
+	if ev != nil {
+		ev.OnEvent(&pkgs.Event{Type: pkgs.EVENT_STARTED, Op: "search", PkgName: name})
+	}
 	result, err := roster.Search(name, 10)
+	if ev != nil {
+		emitResult(ev, "search", name, result, err)
+		if err != nil {
+			return &ExitError{Code: 1}
+		}
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -149,8 +338,8 @@ func doSearch(cmd *cobra.Command, args []string) error {
 			addrLen := 10
 			for _, s := range result.Possibles {
 				if s.Github != nil {
-					if len(s.Name) > nameLen {
-						nameLen = len(s.Name)
+					if len(s.FullName()) > nameLen {
+						nameLen = len(s.FullName())
 					}
 					if len(s.Github.FullName)+len("https://github.com/") > addrLen {
 						addrLen = len(s.Github.FullName) + len("https://github.com") + 1
@@ -160,13 +349,13 @@ func doSearch(cmd *cobra.Command, args []string) error {
 			for _, s := range result.Possibles {
 				if s.Github != nil {
 					addr := fmt.Sprintf("https://github.com/%s", s.Github.FullName)
-					inst, _ := roster.InstalledVersion(s.Name)
+					inst, _ := roster.InstalledVersion(s.FullName())
 					if inst == nil {
-						fmt.Printf("  %-*s %-*s  -\n",
-							nameLen, s.Name, addrLen, addr)
+						fmt.Printf("  %-*s %-*s  -%s\n",
+							nameLen, s.FullName(), addrLen, addr, matchedFields(s))
 					} else {
-						fmt.Printf("  %-*s %-*s  installed: %s\n",
-							nameLen, s.Name, addrLen, addr, inst.Version)
+						fmt.Printf("  %-*s %-*s  installed: %s%s\n",
+							nameLen, s.FullName(), addrLen, addr, inst.Version, matchedFields(s))
 					}
 				}
 			}
@@ -175,6 +364,20 @@ func doSearch(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// matchedFields returns the fields which matched the search, e.g. '  (description: mqtt, topics: mqtt)'.
+func matchedFields(s *pkgs.PackageCache) string {
+	fields := []string{}
+	for _, f := range []pkgs.SearchField{pkgs.SEARCH_KEYWORDS, pkgs.SEARCH_TOPICS, pkgs.SEARCH_DESCRIPTION, pkgs.SEARCH_GITHUB_DESCRIPTION} {
+		if words, ok := s.Matched[f]; ok {
+			fields = append(fields, fmt.Sprintf("%s: %s", f, strings.Join(words, " ")))
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return "  (" + strings.Join(fields, ", ") + ")"
+}
+
 func doUpdate(cmd *cobra.Command, args []string) error {
 	baseDir, err := cmd.Flags().GetString("dir")
 	if err != nil {
@@ -185,7 +388,21 @@ func doUpdate(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	upd, err := roster.Update()
+	ev, err := eventWriter(cmd)
+	if err != nil {
+		return err
+	}
+	if ev != nil {
+		ev.OnEvent(&pkgs.Event{Type: pkgs.EVENT_STARTED, Op: "update"})
+	}
+	upd, err := roster.UpdateContext(cmd.Context())
+	if ev != nil {
+		emitResult(ev, "update", "", upd, err)
+		if err != nil {
+			return &ExitError{Code: 1}
+		}
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -199,6 +416,12 @@ func doUpdate(cmd *cobra.Command, args []string) error {
 			fmt.Println("   no upgradable packages")
 		}
 	}
+	if upd != nil && len(upd.Held) > 0 {
+		fmt.Println("Held packages:")
+		for _, p := range upd.Held {
+			fmt.Println("  ", p.PkgName, p.InstalledVersion, "-->", strings.TrimPrefix(p.LatestRelease, "v"), "held by", p.Hold)
+		}
+	}
 	return nil
 }
 
@@ -212,8 +435,45 @@ func doInstall(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	for _, name := range args {
-		r := roster.Install(name, os.Stdout, nil)
+	ev, err := eventWriter(cmd)
+	if err != nil {
+		return err
+	}
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	archiveFile, _ := cmd.Flags().GetString("file")
+	checksum, _ := cmd.Flags().GetString("checksum")
+	var output io.Writer = os.Stdout
+	var opts []pkgs.OpOption
+	if ev != nil {
+		output = io.Discard
+		opts = append(opts, pkgs.WithEvents(ev))
+	} else {
+		opts = append(opts, pkgs.WithProgress(newProgressBar(os.Stdout)))
+	}
+	if checksum != "" {
+		opts = append(opts, pkgs.WithChecksum(checksum))
+	}
+	if force, _ := cmd.Flags().GetBool("force"); force {
+		opts = append(opts, pkgs.WithForce())
+	}
+	var result []*pkgs.InstallStatus
+	var exitCode int
+	if archiveFile != "" {
+		if len(args) != 1 {
+			return fmt.Errorf("--file requires exactly one package")
+		}
+		result = []*pkgs.InstallStatus{roster.InstallArchiveContext(cmd.Context(), args[0], archiveFile, output, nil, opts...)}
+		if result[0].Err != nil {
+			exitCode = 1
+		}
+	} else {
+		result, exitCode = roster.InstallManyContext(cmd.Context(), args, parallel, output, nil, opts...)
+	}
+	for _, r := range result {
+		if ev != nil {
+			// already emitted
+			break
+		}
 		if r.Err != nil {
 			fmt.Println(r.PkgName, "install failed", r.Err.Error())
 			continue
@@ -224,6 +484,160 @@ func doInstall(cmd *cobra.Command, args []string) error {
 		}
 		fmt.Println(r.PkgName, "installed", r.Installed.Version, r.Installed.Path)
 	}
+	if exitCode != 0 {
+		return &ExitError{Code: exitCode}
+	}
+	return nil
+}
+
+func doUpgrade(cmd *cobra.Command, args []string) error {
+	baseDir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+	all, _ := cmd.Flags().GetBool("all")
+	if all == (len(args) > 0) {
+		return fmt.Errorf("give package names or --all")
+	}
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	roster, err := pkgs.NewRoster(baseDir, pkgs.WithLogger(pkgs.NewLogger(pkgs.ParseLogLevel(logLevel))))
+	if err != nil {
+		return err
+	}
+	ev, err := eventWriter(cmd)
+	if err != nil {
+		return err
+	}
+	upd, err := roster.UpdateContext(cmd.Context())
+	if err != nil {
+		if ev != nil {
+			emitResult(ev, "update", "", nil, err)
+			return &ExitError{Code: 1}
+		}
+		return err
+	}
+	targets := []*pkgs.Upgradable{}
+	exitCode := 0
+	if all {
+		targets = upd.Upgradable
+	} else {
+		for _, name := range args {
+			idx := slices.IndexFunc(upd.Upgradable, func(u *pkgs.Upgradable) bool { return u.PkgName == name })
+			if idx >= 0 {
+				targets = append(targets, upd.Upgradable[idx])
+				continue
+			}
+			if idx := slices.IndexFunc(upd.Held, func(u *pkgs.Upgradable) bool { return u.PkgName == name }); idx >= 0 {
+				if ev == nil {
+					fmt.Println(name, "is held by", upd.Held[idx].Hold)
+				}
+				continue
+			}
+			if _, err := roster.InstalledVersion(name); err != nil {
+				if ev != nil {
+					emitResult(ev, "upgrade", name, nil, err)
+				} else {
+					fmt.Println(name, "not installed")
+				}
+				exitCode = 1
+			} else if ev == nil {
+				fmt.Println(name, "is up to date")
+			}
+		}
+	}
+	if len(targets) == 0 {
+		if ev == nil && all {
+			fmt.Println("All packages are up to date")
+		}
+		if exitCode != 0 {
+			return &ExitError{Code: exitCode}
+		}
+		return nil
+	}
+
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	var output io.Writer = os.Stdout
+	var opts []pkgs.OpOption
+	if ev != nil {
+		output = io.Discard
+		opts = append(opts, pkgs.WithEvents(ev))
+	} else {
+		opts = append(opts, pkgs.WithProgress(newProgressBar(os.Stdout)))
+	}
+	names := []string{}
+	for _, u := range targets {
+		names = append(names, u.PkgName)
+	}
+	result, code := roster.InstallManyContext(cmd.Context(), names, parallel, output, nil, opts...)
+	if code != 0 {
+		exitCode = 1
+	}
+	if ev == nil {
+		fmt.Println("Upgrade summary:")
+		for i, r := range result {
+			from := targets[i].InstalledVersion
+			switch {
+			case r.Err != nil:
+				fmt.Println("  ", r.PkgName, from, "upgrade failed", r.Err.Error())
+			case r.Installed == nil:
+				fmt.Println("  ", r.PkgName, from, "upgrade failed")
+			default:
+				fmt.Println("  ", r.PkgName, from, "-->", r.Installed.Version)
+			}
+		}
+	}
+	if exitCode != 0 {
+		return &ExitError{Code: exitCode}
+	}
+	return nil
+}
+
+func doHold(cmd *cobra.Command, args []string) error {
+	baseDir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	roster, err := pkgs.NewRoster(baseDir, pkgs.WithLogger(pkgs.NewLogger(pkgs.ParseLogLevel(logLevel))))
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		holds, err := roster.Holds()
+		if err != nil {
+			return err
+		}
+		for _, h := range holds {
+			fmt.Printf("%s %s (%s by %s)\n", h.PkgName, h, h.HeldAt.Local().Format(time.DateTime), h.User)
+		}
+		return nil
+	}
+	constraint := ""
+	if len(args) > 1 {
+		constraint = args[1]
+	}
+	hold, err := roster.Hold(args[0], constraint)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Held", hold.PkgName, hold)
+	return nil
+}
+
+func doUnhold(cmd *cobra.Command, args []string) error {
+	baseDir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	roster, err := pkgs.NewRoster(baseDir, pkgs.WithLogger(pkgs.NewLogger(pkgs.ParseLogLevel(logLevel))))
+	if err != nil {
+		return err
+	}
+	if err := roster.Unhold(args[0]); err != nil {
+		return err
+	}
+	fmt.Println("Unheld", args[0])
 	return nil
 }
 
@@ -238,7 +652,51 @@ func doUninstall(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	err = roster.Uninstall(args[0], os.Stdout, nil)
+	ev, err := eventWriter(cmd)
+	if err != nil {
+		return err
+	}
+	var opts []pkgs.OpOption
+	if purge, _ := cmd.Flags().GetBool("purge"); purge {
+		opts = append(opts, pkgs.WithPurge())
+	}
+	if force, _ := cmd.Flags().GetBool("force"); force {
+		opts = append(opts, pkgs.WithForce())
+	}
+	if cascade, _ := cmd.Flags().GetBool("cascade"); cascade {
+		opts = append(opts, pkgs.WithCascade())
+	}
+	plan, err := roster.PlanUninstall(args[0], opts...)
+	var depErr *pkgs.DependentsError
+	if errors.As(err, &depErr) && ev == nil {
+		err = fmt.Errorf("%w, use --cascade to uninstall them too or --force to ignore them", depErr)
+	}
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		if ev != nil {
+			emitResult(ev, "uninstall", args[0], plan, err)
+			if err != nil {
+				return &ExitError{Code: 1}
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		printUninstallPlan(plan)
+		return nil
+	}
+	if ev != nil {
+		opts = append(opts, pkgs.WithEvents(ev))
+		if err := roster.UninstallContext(cmd.Context(), args[0], io.Discard, nil, opts...); err != nil {
+			return &ExitError{Code: 1}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	printUninstallPlan(plan)
+	err = roster.UninstallContext(cmd.Context(), args[0], os.Stdout, nil, opts...)
 	if err != nil {
 		return err
 	}
@@ -246,6 +704,300 @@ func doUninstall(cmd *cobra.Command, args []string) error {
 	return err
 }
 
+func doRdepends(cmd *cobra.Command, args []string) error {
+	baseDir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	roster, err := pkgs.NewRoster(baseDir, pkgs.WithLogger(pkgs.NewLogger(pkgs.ParseLogLevel(logLevel))))
+	if err != nil {
+		return err
+	}
+	tree, err := roster.ReverseDependsTree(args[0])
+	if err != nil {
+		return err
+	}
+	var printNode func(node *pkgs.DependencyNode, indent string)
+	printNode = func(node *pkgs.DependencyNode, indent string) {
+		fmt.Println(indent + node.PkgName)
+		for _, d := range node.Dependents {
+			printNode(d, indent+"    ")
+		}
+	}
+	printNode(tree, "")
+	return nil
+}
+
+func printUninstallPlan(plan *pkgs.UninstallPlan) {
+	for _, dep := range plan.Dependents {
+		fmt.Println("Dependent", dep.PkgName, dep.Version)
+		printUninstallPlan(dep)
+	}
+	fmt.Println("Remove:")
+	for _, p := range plan.Remove {
+		fmt.Println("  ", p)
+	}
+	if len(plan.Keep) > 0 {
+		fmt.Println("Keep:")
+		for _, p := range plan.Keep {
+			fmt.Println("  ", p)
+		}
+	}
+}
+
+func doVerify(cmd *cobra.Command, args []string) error {
+	baseDir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	roster, err := pkgs.NewRoster(baseDir, pkgs.WithLogger(pkgs.NewLogger(pkgs.ParseLogLevel(logLevel))))
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		installed, err := roster.InstalledPackages()
+		if err != nil {
+			return err
+		}
+		args = installed.Installed
+	}
+	exitCode := 0
+	for _, name := range args {
+		result, err := roster.Verify(name)
+		if err != nil {
+			fmt.Println(name, "verify failed", err.Error())
+			exitCode = 2
+			continue
+		}
+		if result.Clean() {
+			fmt.Println(name, result.Version, "ok")
+			continue
+		}
+		fmt.Println(name, result.Version, "changed")
+		for _, p := range result.Modified {
+			fmt.Println("  modified  ", p)
+		}
+		for _, p := range result.Missing {
+			fmt.Println("  missing   ", p)
+		}
+		for _, p := range result.Unexpected {
+			fmt.Println("  unexpected", p)
+		}
+		if exitCode == 0 {
+			exitCode = 1
+		}
+	}
+	if exitCode != 0 {
+		return &ExitError{Code: exitCode}
+	}
+	return nil
+}
+
+func doDoctor(cmd *cobra.Command, args []string) error {
+	baseDir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	roster, err := pkgs.NewRoster(baseDir, pkgs.WithLogger(pkgs.NewLogger(pkgs.ParseLogLevel(logLevel))))
+	if err != nil {
+		return err
+	}
+	fix, _ := cmd.Flags().GetBool("fix")
+	found, err := roster.Doctor(fix)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		fmt.Println("no problems found")
+		return nil
+	}
+	failed := 0
+	for _, f := range found {
+		switch {
+		case !fix:
+			fmt.Println(f.String())
+		case f.Fixed:
+			fmt.Println(f.String(), "fixed")
+		default:
+			fmt.Println(f.String(), "fix failed", f.FixErr.Error())
+			failed++
+		}
+	}
+	if !fix || failed > 0 {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+func doHistory(cmd *cobra.Command, args []string) error {
+	baseDir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	roster, err := pkgs.NewRoster(baseDir, pkgs.WithLogger(pkgs.NewLogger(pkgs.ParseLogLevel(logLevel))))
+	if err != nil {
+		return err
+	}
+	pkgName := ""
+	if len(args) > 0 {
+		pkgName = args[0]
+	}
+	entries, err := roster.History(pkgName)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		version := e.ToVersion
+		if e.FromVersion != "" && e.FromVersion != e.ToVersion {
+			version = strings.TrimSuffix(e.FromVersion+" -> "+e.ToVersion, " -> ")
+		}
+		result := "ok"
+		if !e.Success {
+			result = "failed: " + e.Error
+		}
+		fmt.Printf("%s %-9s %s %s (%.1fs by %s) %s\n",
+			e.Time.Local().Format(time.DateTime), e.Action, e.PkgName, version, e.Duration, e.User, result)
+	}
+	return nil
+}
+
+func doLogs(cmd *cobra.Command, args []string) error {
+	baseDir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	roster, err := pkgs.NewRoster(baseDir, pkgs.WithLogger(pkgs.NewLogger(pkgs.ParseLogLevel(logLevel))))
+	if err != nil {
+		return err
+	}
+	logs, err := roster.ScriptLogs(args[0])
+	if err != nil {
+		return err
+	}
+	if len(logs) == 0 {
+		return fmt.Errorf("no logs of %q", args[0])
+	}
+	if list, _ := cmd.Flags().GetBool("list"); list {
+		for _, l := range logs {
+			fmt.Println(l)
+		}
+		return nil
+	}
+	f, err := os.Open(logs[len(logs)-1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(os.Stdout, f)
+	return err
+}
+
+func archiveStore(cmd *cobra.Command) (*pkgs.ArchiveStore, error) {
+	dir, _ := cmd.Flags().GetString("cache-dir")
+	if dir == "" {
+		if d, err := pkgs.DefaultArchiveStoreDir(); err != nil {
+			return nil, err
+		} else {
+			dir = d
+		}
+	}
+	return pkgs.NewArchiveStore(dir, pkgs.DEFAULT_ARCHIVE_STORE_SIZE), nil
+}
+
+func shortSum(sum string) string {
+	if len(sum) > 12 {
+		return sum[:12]
+	}
+	return sum
+}
+
+func doCacheLs(cmd *cobra.Command, args []string) error {
+	store, err := archiveStore(cmd)
+	if err != nil {
+		return err
+	}
+	entries, err := store.List()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+		fmt.Printf("%s %s %10d %s\n", e.LastUsed.Local().Format(time.DateTime), shortSum(e.Sha256), e.Size, e.Name)
+	}
+	fmt.Printf("%d archives, %d bytes in %s\n", len(entries), total, store.Dir())
+	return nil
+}
+
+func doCacheClean(cmd *cobra.Command, args []string) error {
+	store, err := archiveStore(cmd)
+	if err != nil {
+		return err
+	}
+	maxSize, _ := cmd.Flags().GetInt64("max-size")
+	removed, err := store.Clean(maxSize * 1024 * 1024)
+	var total int64
+	for _, e := range removed {
+		total += e.Size
+		fmt.Println("removed", e.Name, shortSum(e.Sha256))
+	}
+	fmt.Printf("%d archives, %d bytes removed\n", len(removed), total)
+	return err
+}
+
+func rosterOf(cmd *cobra.Command) (*pkgs.Roster, error) {
+	baseDir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return nil, err
+	}
+	logLevel, _ := cmd.Flags().GetString("log-level")
+	return pkgs.NewRoster(baseDir, pkgs.WithLogger(pkgs.NewLogger(pkgs.ParseLogLevel(logLevel))))
+}
+
+func doRosterAdd(cmd *cobra.Command, args []string) error {
+	roster, err := rosterOf(cmd)
+	if err != nil {
+		return err
+	}
+	rosterName, repoUrl := pkgs.RosterName(args[0]), args[1]
+	if err := roster.AddRoster(rosterName, repoUrl); err != nil {
+		return err
+	}
+	fmt.Println("Added", rosterName, repoUrl)
+	if err := roster.SyncContext(cmd.Context(), rosterName, repoUrl); err != nil {
+		return fmt.Errorf("sync %s, %w, run 'update' to retry", rosterName, err)
+	}
+	return nil
+}
+
+func doRosterRm(cmd *cobra.Command, args []string) error {
+	roster, err := rosterOf(cmd)
+	if err != nil {
+		return err
+	}
+	if err := roster.RemoveRoster(pkgs.RosterName(args[0])); err != nil {
+		return err
+	}
+	fmt.Println("Removed", args[0])
+	return nil
+}
+
+func doRosterLs(cmd *cobra.Command, args []string) error {
+	roster, err := rosterOf(cmd)
+	if err != nil {
+		return err
+	}
+	for _, r := range roster.Rosters() {
+		fmt.Println(r.Name, r.RepoUrl)
+	}
+	return nil
+}
+
 func doRebuildCache(cmd *cobra.Command, args []string) error {
 	baseDir, err := cmd.Flags().GetString("dir")
 	if err != nil {
@@ -256,6 +1008,27 @@ func doRebuildCache(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	ev, err := eventWriter(cmd)
+	if err != nil {
+		return err
+	}
+	// report prints the message of the package, or emits it as an event
+	report := func(name string, err error, msg ...any) {
+		text := strings.TrimSuffix(fmt.Sprintln(msg...), "\n")
+		switch {
+		case ev == nil && err != nil:
+			fmt.Println(name, text, err.Error())
+		case ev == nil:
+			fmt.Println(name, text)
+		case err != nil:
+			ev.OnEvent(&pkgs.Event{Type: pkgs.EVENT_ERROR, Op: "rebuild-cache", PkgName: name, Message: text, Error: err.Error()})
+		default:
+			ev.OnEvent(&pkgs.Event{Type: pkgs.EVENT_PROGRESS, Op: "rebuild-cache", PkgName: name, Message: text})
+		}
+	}
+	if ev != nil {
+		ev.OnEvent(&pkgs.Event{Type: pkgs.EVENT_STARTED, Op: "rebuild-cache"})
+	}
 	httpClient := &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -267,35 +1040,35 @@ func doRebuildCache(cmd *cobra.Command, args []string) error {
 		ret = true
 		meta, err := roster.LoadPackageMeta(name)
 		if err != nil {
-			fmt.Println(name, "meta load failed", err.Error())
+			report(name, err, "meta load failed")
 			return
 		}
 		cache, err := roster.UpdatePackageCache(meta)
 		if err != nil {
-			fmt.Println(name, "cache update failed", err.Error())
+			report(name, err, "cache update failed")
 			return
 		}
 		dist, err := cache.RemoteDistribution()
 		if err != nil || len(dist) == 0 {
-			fmt.Println(name, "distribution not found", err.Error())
+			report(name, err, "distribution not found")
 			return
 		}
 		avails := []*pkgs.PackageDistributionAvailability{}
 		for _, pd := range dist {
 			avail, err := pd.CheckAvailability(httpClient)
 			if err != nil {
-				fmt.Println(name, "distribution check failed", err.Error())
+				report(name, err, "distribution check failed")
 				continue
 			}
 			if !avail.Available {
-				fmt.Println(name, cache.LatestVersion, "distribution not available")
+				report(name, nil, cache.Version(), "distribution not available")
 				continue
 			}
-			fmt.Println(name, cache.LatestVersion, avail.DistUrl)
+			report(name, nil, cache.Version(), avail.DistUrl)
 			avails = append(avails, avail)
 		}
 		if len(avails) == 0 {
-			fmt.Println(name, runtime.GOOS, runtime.GOARCH, "distribution not available")
+			report(name, nil, runtime.GOOS, runtime.GOARCH, "distribution not available")
 			return
 		}
 		cache.Platforms = []string{}
@@ -303,16 +1076,19 @@ func doRebuildCache(cmd *cobra.Command, args []string) error {
 			cache.Platforms = append(cache.Platforms, fmt.Sprintf("%s/%s", av.PlatformOS, av.PlatformArch))
 		}
 		if err := roster.WritePackageDistributionAvailability(avails); err != nil {
-			fmt.Println(name, "distribution availability write failed", err.Error())
+			report(name, err, "distribution availability write failed")
 			return
 		}
 		if err := roster.WritePackageCache(cache); err != nil {
-			fmt.Println(name, "cache write failed", err.Error())
+			report(name, err, "cache write failed")
 		}
 		return
 	})
 
-	roster.PushAllCache()
+	err = roster.PushAllCache()
+	if ev != nil {
+		emitResult(ev, "rebuild-cache", "", nil, err)
+	}
 	return nil
 }
 
@@ -474,11 +1250,17 @@ func print(nr *pkgs.PackageCache) {
 		fmt.Println("License             ", nr.Github.License)
 	}
 	fmt.Println("Latest Version      ", nr.LatestVersion)
+	if nr.Revision > 0 {
+		fmt.Println("Revision            ", nr.Revision)
+	}
 	fmt.Println("Latest Release      ", nr.LatestRelease)
 	fmt.Println("Latest Release Tag  ", nr.LatestReleaseTag)
 	fmt.Println("Published At        ", nr.PublishedAt)
 	if nr.Url != "" {
 		fmt.Println("Url                 ", nr.Url)
 	}
+	if nr.ChecksumUrl != "" {
+		fmt.Println("Checksum Url        ", nr.ChecksumUrl)
+	}
 	fmt.Println("StripComponents     ", nr.StripComponents)
 }
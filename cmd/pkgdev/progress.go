@@ -0,0 +1,104 @@
+package pkgdev
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/machbase/neo-pkgdev/pkgs"
+)
+
+// progressBar renders pkgs.InstallProgress as a single line progress bar.
+// If the output is not a terminal, it prints only the phase changes and
+// the final state of the download.
+// It is safe to be used by the packages which are installed in parallel,
+// the bar shows the package which reported its progress most recently.
+type progressBar struct {
+	mu      sync.Mutex
+	w       io.Writer
+	width   int
+	tty     bool
+	lastLen int
+}
+
+var _ pkgs.ProgressObserver = (*progressBar)(nil)
+
+func newProgressBar(w *os.File) *progressBar {
+	tty := false
+	if stat, err := w.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		tty = true
+	}
+	return &progressBar{w: w, width: 30, tty: tty}
+}
+
+func (pb *progressBar) OnProgress(p *pkgs.InstallProgress) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if p.Phase != pkgs.PHASE_DOWNLOAD {
+		pb.clear()
+		fmt.Fprintf(pb.w, "%s %s\n", p.PkgName, p.Phase)
+		return
+	}
+	done := p.BytesTotal > 0 && p.BytesDone >= p.BytesTotal
+	line := pb.render(p)
+	if !pb.tty {
+		if done {
+			fmt.Fprintln(pb.w, line)
+		}
+		return
+	}
+	pad := ""
+	if len(line) < pb.lastLen {
+		pad = strings.Repeat(" ", pb.lastLen-len(line))
+	}
+	fmt.Fprintf(pb.w, "\r%s%s", line, pad)
+	pb.lastLen = len(line)
+	if done {
+		fmt.Fprintln(pb.w)
+		pb.lastLen = 0
+	}
+}
+
+// clear erases the progress bar which is being displayed.
+func (pb *progressBar) clear() {
+	if pb.lastLen > 0 {
+		fmt.Fprintf(pb.w, "\r%s\r", strings.Repeat(" ", pb.lastLen))
+		pb.lastLen = 0
+	}
+}
+
+func (pb *progressBar) render(p *pkgs.InstallProgress) string {
+	if p.BytesTotal <= 0 {
+		return fmt.Sprintf("%s download %s  %s/s",
+			p.PkgName, formatBytes(p.BytesDone), formatBytes(int64(p.Rate)))
+	}
+	ratio := float64(p.BytesDone) / float64(p.BytesTotal)
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * float64(pb.width))
+	bar := strings.Repeat("=", filled)
+	if filled < pb.width {
+		bar += ">" + strings.Repeat(" ", pb.width-filled-1)
+	}
+	return fmt.Sprintf("%s download [%s] %3.0f%%  %s / %s  %s/s  ETA %s",
+		p.PkgName, bar, ratio*100,
+		formatBytes(p.BytesDone), formatBytes(p.BytesTotal),
+		formatBytes(int64(p.Rate)), p.ETA.Round(time.Second))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
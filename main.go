@@ -2,11 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
+	"os"
+	"os/signal"
 
 	"github.com/machbase/neo-pkgdev/cmd/pkgdev"
 	"github.com/spf13/cobra"
 )
 
 func main() {
-	cobra.CheckErr(pkgdev.NewCmd().ExecuteContext(context.Background()))
+	// cancel the running install or uninstall scripts on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := pkgdev.NewCmd().ExecuteContext(ctx)
+	stop()
+	var exitErr *pkgdev.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
+	cobra.CheckErr(err)
 }
@@ -0,0 +1,70 @@
+package pkgs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+)
+
+// archive extensions, multi-part extensions come first.
+var archiveExts = []string{
+	".tar.gz", ".tar.xz", ".tar.bz2", ".tar.zst",
+	".tgz", ".txz", ".tbz2", ".tzst",
+	".tar", ".zip",
+}
+
+// ArchiveExt returns the archive extension of the filename including
+// the multi-part extensions like '.tar.gz'.
+// It returns empty string if the filename does not have a known archive extension.
+func ArchiveExt(filename string) string {
+	lower := strings.ToLower(filename)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(lower, ext) {
+			return filename[len(filename)-len(ext):]
+		}
+	}
+	return ""
+}
+
+// IsTarArchive reports whether the archive extension is one of the tar family,
+// which are extracted by untar.
+func IsTarArchive(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".tar.gz", ".tar.xz", ".tar.bz2", ".tar.zst", ".tgz", ".txz", ".tbz2", ".tzst", ".tar":
+		return true
+	}
+	return false
+}
+
+// DetectArchiveExt sniffs the content of the file and returns the archive extension
+// ('.zip', '.tar', '.tar.gz', '.tar.bz2', '.tar.xz' or '.tar.zst').
+// It returns empty string if the file is not a known archive, which is treated as a single binary.
+func DetectArchiveExt(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return ".zip", nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return ".tar.gz", nil
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return ".tar.bz2", nil
+	case bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return ".tar.xz", nil
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return ".tar.zst", nil
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return ".tar", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,48 @@
+package pkgs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveExt(t *testing.T) {
+	tests := map[string]string{
+		"pkg-1.0.0-linux-amd64.tar.gz":  ".tar.gz",
+		"pkg-1.0.0-linux-amd64.TAR.GZ":  ".TAR.GZ",
+		"pkg-1.0.0.tgz":                 ".tgz",
+		"pkg-1.0.0.tar":                 ".tar",
+		"pkg-1.0.0.tar.xz":              ".tar.xz",
+		"pkg-1.0.0.tar.bz2":             ".tar.bz2",
+		"pkg-1.0.0.tar.zst":             ".tar.zst",
+		"pkg-1.0.0-windows-amd64.zip":   ".zip",
+		"pkg-1.0.0-linux-amd64":         "",
+		"pkg-1.0.0-windows-amd64.exe":   "",
+		"pkg-1.0.0-linux-amd64.gz.json": "",
+	}
+	for name, expect := range tests {
+		require.Equal(t, expect, ArchiveExt(name), name)
+	}
+}
+
+func TestDetectArchiveExt(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]struct {
+		content []byte
+		expect  string
+	}{
+		"targz":  {content: makeTarGz(t, map[string]string{"a.txt": "a"}), expect: ".tar.gz"},
+		"zip":    {content: []byte("PK\x03\x04rest of zip"), expect: ".zip"},
+		"binary": {content: []byte("\x7fELF\x02\x01\x01"), expect: ""},
+		"empty":  {content: []byte{}, expect: ""},
+	}
+	for name, tt := range tests {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, tt.content, 0644))
+		ext, err := DetectArchiveExt(path)
+		require.NoError(t, err, name)
+		require.Equal(t, tt.expect, ext, name)
+	}
+}
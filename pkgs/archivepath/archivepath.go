@@ -0,0 +1,96 @@
+// Package archivepath checks the entry names and the link targets of the archives,
+// so that untar and unzip never write outside of the destination directory.
+package archivepath
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StripComponents removes the leading stripComponents path elements of the slash-separated name p,
+// like 'tar --strip-components'. The name which has no more elements to strip is kept as it is.
+func StripComponents(p string, stripComponents int) string {
+	if stripComponents == 0 {
+		return filepath.FromSlash(p)
+	}
+	p = strings.TrimPrefix(p, "/")
+	for i := 0; i < stripComponents; i++ {
+		if j := strings.Index(p, "/"); j != -1 {
+			p = p[j+1:]
+		}
+	}
+	return filepath.FromSlash(p)
+}
+
+// ValidRelPath reports whether the entry name p is a relative slash-separated path
+// which does not go up to the parent.
+func ValidRelPath(p string) bool {
+	if p == "" || p == ".." || strings.Contains(p, `\`) || strings.HasPrefix(p, "/") || strings.Contains(p, "../") {
+		return false
+	}
+	if len(p) >= 2 && p[1] == ':' {
+		// windows volume name
+		return false
+	}
+	return true
+}
+
+// WithinDir reports whether the path is dir itself or under the dir.
+func WithinDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ValidLinkTarget reports whether the symlink at abs to the linkname resolves in the dir.
+// The '..' elements are allowed only as the leading elements of the linkname,
+// since '..' after a symlink element would resolve against the target of the symlink.
+// Together with CheckNoSymlink, it guarantees that every symlink resolves in the dir.
+func ValidLinkTarget(dir string, abs string, linkname string) bool {
+	if linkname == "" || strings.Contains(linkname, `\`) || strings.HasPrefix(linkname, "/") || filepath.IsAbs(linkname) {
+		return false
+	}
+	leading := true
+	for _, elem := range strings.Split(linkname, "/") {
+		switch elem {
+		case "..":
+			if !leading {
+				return false
+			}
+		case ".", "":
+		default:
+			leading = false
+		}
+	}
+	return WithinDir(dir, filepath.Join(filepath.Dir(abs), filepath.FromSlash(linkname)))
+}
+
+// CheckNoSymlink returns error if any existing parent of the abs under the dir is a symlink,
+// so that an entry is never written through a symlink.
+func CheckNoSymlink(dir string, abs string) error {
+	rel, err := filepath.Rel(dir, filepath.Dir(abs))
+	if err != nil || rel == "." {
+		return err
+	}
+	cur := dir
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, elem)
+		fi, err := os.Lstat(cur)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %q is under the symlink %q", abs, cur)
+		}
+	}
+	return nil
+}
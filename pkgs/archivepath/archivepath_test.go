@@ -0,0 +1,36 @@
+package archivepath_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/machbase/neo-pkgdev/pkgs/archivepath"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripComponents(t *testing.T) {
+	tests := []struct {
+		name            string
+		stripComponents int
+		expected        string
+	}{
+		{"build/index.html", 0, "build/index.html"},
+		{"build/index.html", 1, "index.html"},
+		{"/build/assets/app.js", 1, "assets/app.js"},
+		{"build/", 1, ""},
+		{"README.md", 1, "README.md"},
+		{"a/b/c", 5, "c"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, filepath.FromSlash(tt.expected), archivepath.StripComponents(tt.name, tt.stripComponents), tt.name)
+	}
+}
+
+func TestValidRelPath(t *testing.T) {
+	for _, p := range []string{"a", "a/b", "a/b/", "./a", "a..b"} {
+		require.True(t, archivepath.ValidRelPath(p), p)
+	}
+	for _, p := range []string{"", "..", "../a", "a/../../b", "/etc/passwd", `a\b`, "C:/evil"} {
+		require.False(t, archivepath.ValidRelPath(p), p)
+	}
+}
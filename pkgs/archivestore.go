@@ -0,0 +1,250 @@
+package pkgs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DEFAULT_ARCHIVE_STORE_SIZE is the size cap of the default archive store.
+const DEFAULT_ARCHIVE_STORE_SIZE int64 = 2 * 1024 * 1024 * 1024
+
+// ArchiveStore keeps the downloaded archives by their sha256 checksum,
+// so that reinstalling or installing the same package into other base dirs does not download it again.
+//
+//	<dir>/<sha256>/<archive file name>
+//	<dir>/<sha256>/.sources  the urls which the archive was downloaded from, one per line
+//
+// When the total size exceeds the cap, the least recently used archives are evicted.
+type ArchiveStore struct {
+	dir     string
+	maxSize int64 // 0 means no limit
+}
+
+// ARCHIVE_STORE_SOURCES is the name of the file of the source urls of an archive in the store.
+const ARCHIVE_STORE_SOURCES = ".sources"
+
+// ArchiveStoreEntry is an archive in the store.
+type ArchiveStoreEntry struct {
+	Sha256   string    `json:"sha256"`
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// NewArchiveStore returns the store in the dir, the dir is created when the first archive is put.
+// maxSize 0 means no limit.
+func NewArchiveStore(dir string, maxSize int64) *ArchiveStore {
+	return &ArchiveStore{dir: dir, maxSize: maxSize}
+}
+
+// DefaultArchiveStoreDir returns $NEOPKG_CACHE_DIR, or 'neopkg' in the user cache dir, e.g. '~/.cache/neopkg'.
+func DefaultArchiveStoreDir() (string, error) {
+	if dir := os.Getenv("NEOPKG_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "neopkg"), nil
+}
+
+func (s *ArchiveStore) Dir() string {
+	return s.dir
+}
+
+// Get returns the path of the archive of the checksum, and marks it as recently used.
+// It returns empty string if the store does not have it.
+func (s *ArchiveStore) Get(sha256 string) string {
+	entries, err := os.ReadDir(filepath.Join(s.dir, sha256))
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if !isStoredArchive(entry) {
+			continue
+		}
+		path := filepath.Join(s.dir, sha256, entry.Name())
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return path
+	}
+	return ""
+}
+
+// isStoredArchive reports whether the entry of the checksum dir is the archive,
+// not the temp file of Put() or the sources file.
+func isStoredArchive(entry os.DirEntry) bool {
+	return entry.Type().IsRegular() && filepath.Ext(entry.Name()) != ".tmp" && !strings.HasPrefix(entry.Name(), ".")
+}
+
+// AddSource records that the archive of the checksum was downloaded from the url,
+// so that Lookup() finds it when the checksum of the url can not be fetched, e.g. offline.
+func (s *ArchiveStore) AddSource(sha256 string, srcUrl string) error {
+	if s.Get(sha256) == "" {
+		return fmt.Errorf("archive store: %s not found", sha256)
+	}
+	path := filepath.Join(s.dir, sha256, ARCHIVE_STORE_SOURCES)
+	sources := s.sources(sha256)
+	if slices.Contains(sources, srcUrl) {
+		return nil
+	}
+	sources = append(sources, srcUrl)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(sources, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Lookup returns the checksum of the archive downloaded from the url,
+// it returns empty string if the store does not have it.
+func (s *ArchiveStore) Lookup(srcUrl string) string {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return ""
+	}
+	for _, d := range dirs {
+		if d.IsDir() && slices.Contains(s.sources(d.Name()), srcUrl) {
+			return d.Name()
+		}
+	}
+	return ""
+}
+
+func (s *ArchiveStore) sources(sha256 string) []string {
+	content, err := os.ReadFile(filepath.Join(s.dir, sha256, ARCHIVE_STORE_SOURCES))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(content))
+}
+
+// Put copies the archive file which has the checksum into the store,
+// and evicts the least recently used archives if the store exceeds the size cap.
+func (s *ArchiveStore) Put(sha256 string, archivePath string) (string, error) {
+	if sha256 == "" {
+		return "", fmt.Errorf("archive store: empty checksum")
+	}
+	if path := s.Get(sha256); path != "" {
+		return path, nil
+	}
+	dir := filepath.Join(s.dir, sha256)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, filepath.Base(archivePath))
+	// the other processes may read the store, copy into the temp file and rename it
+	tmp, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return "", err
+	}
+	src, err := os.Open(archivePath)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	_, err = io.Copy(tmp, src)
+	src.Close()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if s.maxSize > 0 {
+		s.evict(s.maxSize, sha256)
+	}
+	return path, nil
+}
+
+// Remove removes the archive of the checksum from the store.
+func (s *ArchiveStore) Remove(sha256 string) error {
+	if sha256 == "" {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(s.dir, sha256))
+}
+
+// List returns the archives in the store, the most recently used first.
+func (s *ArchiveStore) List() ([]*ArchiveStoreEntry, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	ret := []*ArchiveStoreEntry{}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(s.dir, d.Name()))
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if !isStoredArchive(f) {
+				continue
+			}
+			info, err := f.Info()
+			if err != nil {
+				continue
+			}
+			ret = append(ret, &ArchiveStoreEntry{
+				Sha256:   d.Name(),
+				Name:     f.Name(),
+				Path:     filepath.Join(s.dir, d.Name(), f.Name()),
+				Size:     info.Size(),
+				LastUsed: info.ModTime(),
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].LastUsed.After(ret[j].LastUsed)
+	})
+	return ret, nil
+}
+
+// Clean evicts the least recently used archives until the total size is not greater than maxSize,
+// maxSize 0 removes all archives. It returns the removed archives.
+func (s *ArchiveStore) Clean(maxSize int64) ([]*ArchiveStoreEntry, error) {
+	return s.evict(maxSize, "")
+}
+
+func (s *ArchiveStore) evict(maxSize int64, keep string) ([]*ArchiveStoreEntry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	ret := []*ArchiveStoreEntry{}
+	for i := len(entries) - 1; i >= 0 && total > maxSize; i-- {
+		e := entries[i]
+		if e.Sha256 == keep {
+			continue
+		}
+		if err := s.Remove(e.Sha256); err != nil {
+			return ret, err
+		}
+		total -= e.Size
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
@@ -0,0 +1,146 @@
+package pkgs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveStore(t *testing.T) {
+	store := NewArchiveStore(t.TempDir(), 25)
+	src := t.TempDir()
+	for i, name := range []string{"a.tar.gz", "b.tar.gz", "c.tar.gz"} {
+		path := filepath.Join(src, name)
+		require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0644))
+		stored, err := store.Put(name, path)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(store.Dir(), name, name), stored)
+		// make the order of the last use stable
+		used := time.Now().Add(time.Duration(i-10) * time.Second)
+		require.NoError(t, os.Chtimes(stored, used, used))
+		if name == "b.tar.gz" {
+			// 'a' is used after 'b'
+			require.NotEmpty(t, store.Get("a.tar.gz"))
+		}
+	}
+	// 'b' is the least recently used
+	entries, err := store.List()
+	require.NoError(t, err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	require.Equal(t, []string{"a.tar.gz", "c.tar.gz"}, names)
+	require.Empty(t, store.Get("b.tar.gz"))
+
+	// the sources file is not an archive
+	require.NoError(t, store.AddSource("a.tar.gz", "http://example.com/a.tar.gz"))
+	require.NoError(t, store.AddSource("a.tar.gz", "http://example.com/a.tar.gz"))
+	require.Equal(t, "a.tar.gz", store.Lookup("http://example.com/a.tar.gz"))
+	require.Empty(t, store.Lookup("http://example.com/c.tar.gz"))
+	require.Error(t, store.AddSource("b.tar.gz", "http://example.com/b.tar.gz"))
+	entries, err = store.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	removed, err := store.Clean(0)
+	require.NoError(t, err)
+	require.Len(t, removed, 2)
+	entries, err = store.List()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// installs into two base dirs download the archive once
+	archive := makeTarGz(t, map[string]string{"index.html": "alpha"})
+	sum := sha256.Sum256(archive)
+	hits := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write(archive)
+	}))
+	t.Cleanup(svr.Close)
+	store = NewArchiveStore(t.TempDir(), 0)
+	for i := 0; i < 2; i++ {
+		baseDir := t.TempDir()
+		writeTestPackage(t, baseDir, ROSTER_CENTRAL, "alpha", svr.URL+"/alpha-1.0.0.tar.gz")
+		cachePath := filepath.Join(baseDir, "meta", string(ROSTER_CENTRAL), ".cache", "alpha", "cache.yml")
+		cache, err := ReadPackageCacheFile(cachePath)
+		require.NoError(t, err)
+		cache.Checksums = map[string]string{"*": "sha256:" + hex.EncodeToString(sum[:])}
+		require.NoError(t, WritePackageCacheFile(cachePath, cache))
+
+		roster, err := NewRoster(baseDir, WithArchiveStore(store))
+		require.NoError(t, err)
+		out := &bytes.Buffer{}
+		st := roster.Install("alpha", out, nil)
+		require.NoError(t, st.Err)
+		require.Equal(t, 1, hits)
+		if i == 1 {
+			require.Contains(t, out.String(), "using cached alpha-1.0.0.tar.gz")
+		}
+		content, err := os.ReadFile(filepath.Join(st.Installed.CurrentPath, "index.html"))
+		require.NoError(t, err)
+		require.Equal(t, "alpha", string(content))
+	}
+	require.NotEmpty(t, store.Get(hex.EncodeToString(sum[:])))
+}
+
+func TestArchiveStoreOffline(t *testing.T) {
+	roster, _ := newTestRoster(t, nil)
+	store := NewArchiveStore(t.TempDir(), 0)
+	roster.archiveStore = store
+	writeTestPackage(t, roster.baseDir, ROSTER_CENTRAL, "echo", "")
+	archive := makeTarGz(t, map[string]string{"index.html": "echo"})
+	sum := sha256.Sum256(archive)
+	sumStatus, sumFile := http.StatusOK, []byte(base64.StdEncoding.EncodeToString(sum[:]))
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/machbase/echo/echo-1.0.0.tar.gz":
+			w.Write(archive)
+		case "/machbase/echo/echo-1.0.0.tar.gz.sum":
+			w.WriteHeader(sumStatus)
+			w.Write(sumFile)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(svr.Close)
+	conf := "artifacts:\n  base_url: " + svr.URL + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(roster.metaDir, string(ROSTER_CENTRAL), ROSTER_CONFIG_FILE), []byte(conf), 0644))
+	installTestPackage(t, roster, "echo")
+	require.Equal(t, hex.EncodeToString(sum[:]), store.Lookup(svr.URL+"/machbase/echo/echo-1.0.0.tar.gz"))
+	require.NoError(t, roster.Uninstall("echo", io.Discard, nil))
+
+	// the archive may be withdrawn or replaced, the stored one is not used
+	sumStatus = http.StatusNotFound
+	require.ErrorContains(t, roster.Install("echo", io.Discard, nil).Err, "404 Not Found")
+	sumStatus, sumFile = http.StatusOK, []byte("not a checksum")
+	require.ErrorContains(t, roster.Install("echo", io.Discard, nil).Err, "invalid checksum file")
+
+	// the checksum file can not be fetched, the archive of the url in the store is used
+	svr.Close()
+	out := &bytes.Buffer{}
+	st := roster.Install("echo", out, nil)
+	require.NoError(t, st.Err, out.String())
+	require.Contains(t, out.String(), "checksum of echo-1.0.0.tar.gz is not available")
+	require.Contains(t, out.String(), "using cached echo-1.0.0.tar.gz")
+	content, err := os.ReadFile(filepath.Join(st.Installed.CurrentPath, "index.html"))
+	require.NoError(t, err)
+	require.Equal(t, "echo", string(content))
+
+	// the archive which is not in the store can not be installed offline
+	require.NoError(t, roster.Uninstall("echo", io.Discard, nil))
+	_, err = store.Clean(0)
+	require.NoError(t, err)
+	require.Error(t, roster.Install("echo", io.Discard, nil).Err)
+}
@@ -25,6 +25,17 @@ func Audit(pathPackageYml string, output io.Writer) error {
 	fmt.Fprintln(output, "   ", "Github:", meta.Distributable.Github)
 	fmt.Fprintln(output, "   ", "Url:", meta.Distributable.Url)
 	fmt.Fprintln(output, "   ", "StripComponents:", meta.Distributable.StripComponents)
+	if meta.Distributable.ChecksumUrl != "" {
+		fmt.Fprintln(output, "   ", "ChecksumUrl:", meta.Distributable.ChecksumUrl)
+	}
+	if err := auditChecksums(meta); err != nil {
+		return err
+	}
+	if meta.Revision < 0 {
+		return fmt.Errorf("revision %d is invalid", meta.Revision)
+	} else if meta.Revision > 0 {
+		fmt.Fprintln(output, "   ", "Revision:", meta.Revision)
+	}
 	if err := auditDescription(meta); err != nil {
 		return err
 	} else {
@@ -156,6 +167,15 @@ func auditPlatforms(meta *pkgs.PackageMeta) error {
 	return nil
 }
 
+func auditChecksums(meta *pkgs.PackageMeta) error {
+	for platform, digest := range meta.Distributable.Checksums {
+		if _, err := pkgs.ParseDigest(digest); err != nil {
+			return fmt.Errorf("checksum of %q is invalid: %w", platform, err)
+		}
+	}
+	return nil
+}
+
 func auditDescription(meta *pkgs.PackageMeta) error {
 	desc := strings.TrimSpace(meta.Description)
 	if desc == "" {
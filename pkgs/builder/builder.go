@@ -39,6 +39,14 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 	if err != nil {
 		return err
 	}
+	if abs, err := filepath.Abs(pathPackageYml); err == nil {
+		pathPackageYml = abs
+	}
+	rosterConf, err := pkgs.LoadRosterConfigFile(pkgs.RosterDirOf(pathPackageYml))
+	if err != nil {
+		return err
+	}
+	artifacts := rosterConf.Artifacts
 	httpClient := &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -57,8 +65,15 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 
 	var versionName = strings.TrimPrefix(latestInfo.Name, "v")
 	versionName = strings.TrimPrefix(versionName, "V")
+	// the rebuilt artifacts of the same upstream version have the revision, e.g. '1.2.3-r2'
+	versionName = pkgs.RevisionVersion(versionName, meta.Revision)
 	if meta.PackageName() == "neo-pkg-web-example" {
-		rsp, err := httpClient.Head(fmt.Sprintf("https://p-edge-packages.s3.ap-northeast-2.amazonaws.com/neo-pkg/machbase/neo-pkg-web-example/neo-pkg-web-example-%s.tar.gz", versionName))
+		file := fmt.Sprintf("neo-pkg-web-example-%s.tar.gz", versionName)
+		distUrl, err := artifacts.DownloadUrl("machbase", "neo-pkg-web-example", file, map[string]string{"version": versionName})
+		if err != nil {
+			return err
+		}
+		rsp, err := httpClient.Head(distUrl)
 		if err == nil && rsp.StatusCode == 200 {
 			fmt.Fprintln(output, "Skip Build.")
 			return nil
@@ -106,6 +121,15 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 	}
 
 	buildRun := pkgs.FindScript(meta.BuildRecipe.Scripts, runtime.GOOS)
+	// keep the output of the scripts next to dest, the logs in dest could be packed into the artifact
+	logDir := buildLogDir(dest)
+	fmt.Fprintln(output, "Build logs", logDir)
+	buildLog, err := pkgs.OpenScriptLog(logDir, "build", pkgs.DEFAULT_MAX_SCRIPT_LOGS)
+	if err != nil {
+		return err
+	}
+	defer buildLog.Close()
+	buildOut, buildErr := io.MultiWriter(os.Stdout, buildLog), io.MultiWriter(os.Stderr, buildLog)
 
 	if runtime.GOOS == "windows" {
 		// Windows build script
@@ -118,8 +142,8 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 		buildCmd := exec.Command("cmd", "/c", buildScript)
 		buildCmd.Dir = dest
 		buildCmd.Env = append(os.Environ(), meta.BuildRecipe.Env...)
-		buildCmd.Stdout = os.Stdout
-		buildCmd.Stderr = os.Stderr
+		buildCmd.Stdout = buildOut
+		buildCmd.Stderr = buildErr
 		if err := buildCmd.Run(); err != nil {
 			return err
 		}
@@ -135,8 +159,8 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 		buildCmd := exec.Command("sh", "-c", buildScript)
 		buildCmd.Dir = dest
 		buildCmd.Env = append(os.Environ(), meta.BuildRecipe.Env...)
-		buildCmd.Stdout = os.Stdout
-		buildCmd.Stderr = os.Stderr
+		buildCmd.Stdout = buildOut
+		buildCmd.Stderr = buildErr
 		if err := buildCmd.Run(); err != nil {
 			return err
 		}
@@ -144,6 +168,12 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 	// Test the built files
 	if meta.TestRecipe != nil {
 		testRun := pkgs.FindScript(meta.TestRecipe.Scripts, runtime.GOOS)
+		testLog, err := pkgs.OpenScriptLog(logDir, "test", pkgs.DEFAULT_MAX_SCRIPT_LOGS)
+		if err != nil {
+			return err
+		}
+		defer testLog.Close()
+		testOut, testErr := io.MultiWriter(os.Stdout, testLog), io.MultiWriter(os.Stderr, testLog)
 
 		if runtime.GOOS == "windows" {
 			var testScript string
@@ -156,8 +186,8 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 			testCmd := exec.Command("cmd", "/c", testScript)
 			testCmd.Dir = dest
 			testCmd.Env = append(os.Environ(), meta.BuildRecipe.Env...)
-			testCmd.Stdout = os.Stdout
-			testCmd.Stderr = os.Stderr
+			testCmd.Stdout = testOut
+			testCmd.Stderr = testErr
 			if err := testCmd.Run(); err != nil {
 				return err
 			}
@@ -171,8 +201,8 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 			testCmd := exec.Command("sh", "-c", testScript)
 			testCmd.Dir = dest
 			testCmd.Env = append(os.Environ(), meta.TestRecipe.Env...)
-			testCmd.Stdout = os.Stdout
-			testCmd.Stderr = os.Stderr
+			testCmd.Stdout = testOut
+			testCmd.Stderr = testErr
 			if err := testCmd.Run(); err != nil {
 				return err
 			}
@@ -205,10 +235,10 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 	}
 	fmt.Fprintf(output, "Build done %s\n", archivePath)
 
-	// Deploy the built files to S3
+	// Deploy the built files to the artifact store
 	s3_key_id := os.Getenv("AWS_ACCESS_KEY_ID")
 	s3_secret_key := os.Getenv("AWS_SECRET_ACCESS_KEY")
-	if s3_key_id != "" && s3_secret_key != "" {
+	if s3_key_id != "" && s3_secret_key != "" && artifacts.Bucket != "" {
 		file, err := os.Open(filepath.Join(dest, archivePath))
 		if err != nil {
 			return err
@@ -227,17 +257,24 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 		defer file.Close()
 
 		cfg, err := config.LoadDefaultConfig(context.TODO(),
-			config.WithRegion("ap-northeast-2"),
 			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(s3_key_id, s3_secret_key, "")),
+			config.WithRegion(artifacts.S3Region()),
 		)
 		if err != nil {
 			return err
 		}
-		client := s3.NewFromConfig(cfg)
+		client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+			if artifacts.Endpoint != "" {
+				// S3 compatible store, e.g. MinIO
+				o.BaseEndpoint = aws.String(artifacts.Endpoint)
+				o.UsePathStyle = true
+			}
+		})
+		objectKey := artifacts.ObjectKey(org, repo, filepath.Base(archivePath))
 		_, err = client.PutObject(context.TODO(),
 			&s3.PutObjectInput{
-				Bucket:         aws.String("p-edge-packages"),
-				Key:            aws.String(fmt.Sprintf("neo-pkg/%s/%s/%s", org, repo, filepath.Base(archivePath))),
+				Bucket:         aws.String(artifacts.Bucket),
+				Key:            aws.String(objectKey),
 				Body:           file,
 				ChecksumSHA256: aws.String(checksum),
 			})
@@ -247,8 +284,8 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 
 		_, err = client.PutObject(context.TODO(),
 			&s3.PutObjectInput{
-				Bucket: aws.String("p-edge-packages"),
-				Key:    aws.String(fmt.Sprintf("neo-pkg/%s/%s/%s.sum", org, repo, filepath.Base(archivePath))),
+				Bucket: aws.String(artifacts.Bucket),
+				Key:    aws.String(objectKey + ".sum"),
 				Body:   strings.NewReader(checksum),
 			})
 		if err != nil {
@@ -260,3 +297,9 @@ func Build(pathPackageYml string, dest string, output io.Writer) error {
 	}
 	return nil
 }
+
+// buildLogDir returns the dir of the build and test logs, '<dest>-logs',
+// which is out of the source tree extracted into the dest.
+func buildLogDir(dest string) string {
+	return filepath.Clean(dest) + "-logs"
+}
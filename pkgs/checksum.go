@@ -0,0 +1,79 @@
+package pkgs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ParseChecksum parses the content of a checksum file and returns
+// the hex encoded sha256 digest of the filename.
+// The content can be one of
+//   - base64 encoded sha256 digest, the '.sum' file of the neo-pkg artifacts
+//   - hex encoded sha256 digest, optionally prefixed by 'sha256:'
+//   - SHA256SUMS or sha256sum format, '<hex digest> [*]<filename>' per line
+func ParseChecksum(content []byte, filename string) (string, error) {
+	text := strings.TrimSpace(string(content))
+	if text == "" {
+		return "", fmt.Errorf("empty checksum")
+	}
+	if !strings.ContainsAny(text, " \t\n") {
+		return ParseDigest(text)
+	}
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		name := strings.TrimPrefix(fields[1], "*")
+		name = strings.TrimPrefix(name, "./")
+		if name == filename || path.Base(name) == filename {
+			return ParseDigest(fields[0])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("checksum of %q not found", filename)
+}
+
+// ParseDigest returns the hex encoded sha256 digest from the hex or base64 encoded digest.
+func ParseDigest(digest string) (string, error) {
+	digest = strings.TrimSpace(digest)
+	digest = strings.TrimPrefix(strings.TrimPrefix(digest, "sha256:"), "SHA256:")
+	if len(digest) == sha256.Size*2 {
+		if b, err := hex.DecodeString(digest); err == nil {
+			return hex.EncodeToString(b), nil
+		}
+	}
+	if b, err := base64.StdEncoding.DecodeString(digest); err == nil && len(b) == sha256.Size {
+		return hex.EncodeToString(b), nil
+	}
+	return "", fmt.Errorf("invalid sha256 digest %q", digest)
+}
+
+// FileChecksum returns the hex encoded sha256 digest of the file.
+func FileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hmx := sha256.New()
+	if _, err := io.Copy(hmx, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hmx.Sum(nil)), nil
+}
@@ -0,0 +1,46 @@
+package pkgs
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello"))
+	hexSum := hex.EncodeToString(sum[:])
+	b64Sum := base64.StdEncoding.EncodeToString(sum[:])
+	otherSum := sha256.Sum256([]byte("world"))
+	otherHex := hex.EncodeToString(otherSum[:])
+
+	tests := []struct {
+		name    string
+		content string
+		expect  string
+		fail    bool
+	}{
+		{name: "base64", content: b64Sum, expect: hexSum},
+		{name: "hex", content: hexSum + "\n", expect: hexSum},
+		{name: "prefixed", content: "sha256:" + hexSum, expect: hexSum},
+		{name: "sha256sum", content: hexSum + "  pkg-1.0.0-linux-amd64.tar.gz\n", expect: hexSum},
+		{name: "binary mode", content: hexSum + " *pkg-1.0.0-linux-amd64.tar.gz\n", expect: hexSum},
+		{name: "SHA256SUMS", content: "# checksums\n" +
+			otherHex + "  pkg-1.0.0-darwin-arm64.tar.gz\n" +
+			hexSum + "  ./dist/pkg-1.0.0-linux-amd64.tar.gz\n", expect: hexSum},
+		{name: "not listed", content: otherHex + "  pkg-1.0.0-darwin-arm64.tar.gz\n", fail: true},
+		{name: "invalid", content: "not-a-digest", fail: true},
+		{name: "empty", content: "", fail: true},
+	}
+	for _, tt := range tests {
+		ret, err := ParseChecksum([]byte(tt.content), "pkg-1.0.0-linux-amd64.tar.gz")
+		if tt.fail {
+			require.Error(t, err, tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+		require.Equal(t, tt.expect, ret, tt.name)
+	}
+}
@@ -0,0 +1,122 @@
+package pkgs
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// WithForce makes Uninstall remove the package even if the other installed packages depend on it,
+// and Install install the package even if its hold does not allow the version.
+func WithForce() OpOption {
+	return func(o *opOptions) {
+		o.force = true
+	}
+}
+
+// WithCascade makes Uninstall remove the installed packages which depend on the package first.
+func WithCascade() OpOption {
+	return func(o *opOptions) {
+		o.cascade = true
+	}
+}
+
+// DependentsError is returned by Uninstall if the other installed packages depend on the package.
+type DependentsError struct {
+	PkgName    string
+	Dependents []string
+}
+
+func (e *DependentsError) Error() string {
+	return fmt.Sprintf("package %q is required by %s", e.PkgName, strings.Join(e.Dependents, ", "))
+}
+
+// DependencyNode is a package and the installed packages which depend on it.
+type DependencyNode struct {
+	PkgName    string            `json:"pkg_name"`
+	Dependents []*DependencyNode `json:"dependents,omitempty"`
+}
+
+// Depends returns the packages which the installed package depends on,
+// they are recorded in the install manifest, or read from the package.yml if the manifest does not exist.
+func (r *Roster) Depends(pkgName string) ([]string, error) {
+	inst, err := r.InstalledVersion(pkgName)
+	if err != nil {
+		return nil, err
+	}
+	if manifest, err := inst.Manifest(); err == nil {
+		return manifest.Depends, nil
+	}
+	meta, err := r.LoadPackageMeta(pkgName)
+	if err != nil || meta == nil {
+		return nil, err
+	}
+	return meta.Depends, nil
+}
+
+// ReverseDepends returns the installed packages which depend on the package directly.
+func (r *Roster) ReverseDepends(pkgName string) ([]string, error) {
+	installed, err := r.InstalledPackages()
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, name := range installed.Installed {
+		if name == pkgName {
+			continue
+		}
+		depends, err := r.Depends(name)
+		if err != nil {
+			// being installed or broken
+			continue
+		}
+		if slices.Contains(depends, pkgName) {
+			ret = append(ret, name)
+		}
+	}
+	return ret, nil
+}
+
+// ReverseDependsTree returns the graph of the installed packages which depend on the package
+// directly or indirectly. A package which appears again in its own dependents is not expanded.
+func (r *Roster) ReverseDependsTree(pkgName string) (*DependencyNode, error) {
+	return r.reverseDependsTree(pkgName, []string{})
+}
+
+func (r *Roster) reverseDependsTree(pkgName string, path []string) (*DependencyNode, error) {
+	ret := &DependencyNode{PkgName: pkgName}
+	if slices.Contains(path, pkgName) {
+		// circular dependency
+		return ret, nil
+	}
+	dependents, err := r.ReverseDepends(pkgName)
+	if err != nil {
+		return nil, err
+	}
+	path = append(path, pkgName)
+	for _, name := range dependents {
+		node, err := r.reverseDependsTree(name, path)
+		if err != nil {
+			return nil, err
+		}
+		ret.Dependents = append(ret.Dependents, node)
+	}
+	return ret, nil
+}
+
+// UninstallOrder returns the dependents of the node in the order to uninstall them,
+// the packages which depend on the others come first, the node itself is not included.
+func (node *DependencyNode) UninstallOrder() []string {
+	ret := []string{}
+	var walk func(n *DependencyNode)
+	walk = func(n *DependencyNode) {
+		for _, d := range n.Dependents {
+			walk(d)
+		}
+		if n.PkgName != node.PkgName && !slices.Contains(ret, n.PkgName) {
+			ret = append(ret, n.PkgName)
+		}
+	}
+	walk(node)
+	return ret
+}
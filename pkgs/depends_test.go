@@ -0,0 +1,81 @@
+package pkgs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDepends(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz":   makeTarGz(t, map[string]string{"index.html": "alpha"}),
+		"bravo-1.0.0.tar.gz":   makeTarGz(t, map[string]string{"index.html": "bravo"}),
+		"charlie-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "charlie"}),
+	})
+	// charlie -> bravo -> alpha, charlie -> alpha
+	appendTestMeta(t, roster, "bravo", "depends: [alpha]\n")
+	appendTestMeta(t, roster, "charlie", "depends: [bravo, alpha]\n")
+	installAll := func() {
+		_, exitCode := roster.InstallMany([]string{"alpha", "bravo", "charlie"}, 1, io.Discard, nil)
+		require.Equal(t, 0, exitCode)
+	}
+	installAll()
+
+	depends, err := roster.Depends("charlie")
+	require.NoError(t, err)
+	require.Equal(t, []string{"bravo", "alpha"}, depends)
+	rdepends, err := roster.ReverseDepends("alpha")
+	require.NoError(t, err)
+	require.Equal(t, []string{"bravo", "charlie"}, rdepends)
+
+	tree, err := roster.ReverseDependsTree("alpha")
+	require.NoError(t, err)
+	require.Equal(t, &DependencyNode{PkgName: "alpha", Dependents: []*DependencyNode{
+		{PkgName: "bravo", Dependents: []*DependencyNode{{PkgName: "charlie"}}},
+		{PkgName: "charlie"},
+	}}, tree)
+	require.Equal(t, []string{"charlie", "bravo"}, tree.UninstallOrder())
+
+	// the plan is refused as the uninstall is, or has the dependents to uninstall first
+	_, err = roster.PlanUninstall("alpha")
+	depErr := &DependentsError{}
+	require.ErrorAs(t, err, &depErr)
+	require.Equal(t, []string{"charlie", "bravo"}, depErr.Dependents)
+	plan, err := roster.PlanUninstall("alpha", WithCascade())
+	require.NoError(t, err)
+	require.Equal(t, "alpha", plan.PkgName)
+	require.Len(t, plan.Dependents, 2)
+	for i, name := range []string{"charlie", "bravo"} {
+		require.Equal(t, name, plan.Dependents[i].PkgName)
+		require.Contains(t, plan.Dependents[i].Remove, filepath.Join(roster.pkgDir(name), "current"))
+	}
+	plan, err = roster.PlanUninstall("alpha", WithForce())
+	require.NoError(t, err)
+	require.Empty(t, plan.Dependents)
+
+	// the depends are recorded at install time
+	bravoMeta, err := os.ReadFile(testMetaPath(roster, "bravo"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(testMetaPath(roster, "bravo"), []byte("distributable:\n  github: machbase/bravo\n"), 0644))
+	err = roster.Uninstall("alpha", io.Discard, nil)
+	depErr = &DependentsError{}
+	require.ErrorAs(t, err, &depErr)
+	require.Equal(t, []string{"charlie", "bravo"}, depErr.Dependents)
+	_, err = roster.InstalledVersion("alpha")
+	require.NoError(t, err)
+
+	require.NoError(t, roster.Uninstall("alpha", io.Discard, nil, WithForce()))
+	installed, err := roster.InstalledPackages()
+	require.NoError(t, err)
+	require.Equal(t, []string{"bravo", "charlie"}, installed.Installed)
+
+	require.NoError(t, os.WriteFile(testMetaPath(roster, "bravo"), bravoMeta, 0644))
+	installAll()
+	require.NoError(t, roster.Uninstall("alpha", io.Discard, nil, WithCascade()))
+	installed, err = roster.InstalledPackages()
+	require.NoError(t, err)
+	require.Empty(t, installed.Installed)
+}
@@ -0,0 +1,132 @@
+package pkgs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EVENT_STARTED       EventType = "started"
+	EVENT_PROGRESS      EventType = "progress"
+	EVENT_SCRIPT_OUTPUT EventType = "script-output"
+	EVENT_FINISHED      EventType = "finished"
+	EVENT_ERROR         EventType = "error"
+)
+
+// Event is emitted while an operation (install, uninstall, update, ...) runs.
+// The field names are stable, so that the events can be forwarded to the other processes as JSON.
+type Event struct {
+	Type     EventType        `json:"type"`
+	Time     time.Time        `json:"time"`
+	Op       string           `json:"op"`
+	PkgName  string           `json:"pkg_name,omitempty"`
+	Progress *InstallProgress `json:"progress,omitempty"` // progress of install
+	Output   string           `json:"output,omitempty"`   // a line of the script output
+	Message  string           `json:"message,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Result   any              `json:"result,omitempty"` // result of the finished operation
+}
+
+type EventObserver interface {
+	OnEvent(evt *Event)
+}
+
+// EventFunc is an adapter to allow the use of ordinary functions as EventObserver.
+type EventFunc func(evt *Event)
+
+func (f EventFunc) OnEvent(evt *Event) {
+	f(evt)
+}
+
+// JSONEventWriter writes the events as newline-delimited JSON, it is safe for concurrent use.
+type JSONEventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONEventWriter(w io.Writer) *JSONEventWriter {
+	return &JSONEventWriter{enc: json.NewEncoder(w)}
+}
+
+func (jw *JSONEventWriter) OnEvent(evt *Event) {
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	jw.enc.Encode(evt)
+}
+
+// WithEvents makes the operation emit the events to the observer,
+// including the progress and the output of the scripts line by line.
+func WithEvents(obs EventObserver) OpOption {
+	return func(o *opOptions) {
+		o.events = obs
+	}
+}
+
+func (o *opOptions) emit(evt *Event) {
+	if o.events == nil {
+		return
+	}
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	o.events.OnEvent(evt)
+}
+
+// emitResult emits the finished event, or the error event if err is not nil.
+func (o *opOptions) emitResult(op string, pkgName string, result any, err error) {
+	if err != nil {
+		o.emit(&Event{Type: EVENT_ERROR, Op: op, PkgName: pkgName, Error: err.Error()})
+	} else {
+		o.emit(&Event{Type: EVENT_FINISHED, Op: op, PkgName: pkgName, Result: result})
+	}
+}
+
+// output returns the writer which also emits the script-output events for the lines written.
+// The returned flush func must be called when the operation is done.
+func (o *opOptions) output(op string, pkgName string, w io.Writer) (io.Writer, func()) {
+	if o.events == nil {
+		return w, func() {}
+	}
+	ew := &eventWriter{opts: o, op: op, pkgName: pkgName}
+	return io.MultiWriter(w, ew), ew.Flush
+}
+
+// eventWriter emits a script-output event for each line written.
+type eventWriter struct {
+	opts    *opOptions
+	op      string
+	pkgName string
+	buf     []byte
+}
+
+func (ew *eventWriter) Write(p []byte) (int, error) {
+	ew.buf = append(ew.buf, p...)
+	for {
+		idx := bytes.IndexByte(ew.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		ew.emitLine(ew.buf[:idx])
+		ew.buf = ew.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+func (ew *eventWriter) Flush() {
+	if len(ew.buf) > 0 {
+		ew.emitLine(ew.buf)
+		ew.buf = nil
+	}
+}
+
+func (ew *eventWriter) emitLine(line []byte) {
+	ew.opts.emit(&Event{Type: EVENT_SCRIPT_OUTPUT, Op: ew.op, PkgName: ew.pkgName, Output: string(bytes.TrimSuffix(line, []byte("\r")))})
+}
@@ -0,0 +1,149 @@
+package pkgs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRoster makes a roster in a temp directory which has the given packages
+// whose distributions are served by a local http server.
+func newTestRoster(t *testing.T, archives map[string][]byte) (*Roster, *httptest.Server) {
+	t.Helper()
+	mux := http.NewServeMux()
+	for name, content := range archives {
+		content := content
+		mux.HandleFunc("/"+name, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(content)
+		})
+	}
+	svr := httptest.NewServer(mux)
+	t.Cleanup(svr.Close)
+
+	baseDir := t.TempDir()
+	for name := range archives {
+		if !strings.Contains(name, "-") {
+			// not a package archive
+			continue
+		}
+		pkgName := strings.SplitN(name, "-", 2)[0]
+		writeTestPackage(t, baseDir, ROSTER_CENTRAL, pkgName, svr.URL+"/"+name)
+	}
+	// keep the tests off the shared archive store in the user cache dir
+	roster, err := NewRoster(baseDir, WithArchiveStore(nil))
+	require.NoError(t, err)
+	return roster, svr
+}
+
+// writeTestPackage writes the package.yml and the cache.yml of the package
+// whose distribution is downloaded from the url.
+func writeTestPackage(t *testing.T, baseDir string, rosterName RosterName, pkgName string, url string) {
+	t.Helper()
+	prjDir := filepath.Join(baseDir, "meta", string(rosterName), "projects", pkgName)
+	require.NoError(t, os.MkdirAll(prjDir, 0755))
+	meta := "distributable:\n  github: machbase/" + pkgName + "\n  strip_components: 1\n" +
+		"description: test package\n" +
+		"install:\n  scripts:\n    - run: echo installing " + pkgName + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(prjDir, "package.yml"), []byte(meta), 0644))
+	cache := &PackageCache{
+		Name:            pkgName,
+		Github:          &GhRepoInfo{Organization: "machbase", Repo: pkgName},
+		LatestVersion:   "1.0.0",
+		LatestRelease:   "v1.0.0",
+		StripComponents: 1,
+		Url:             url,
+		rosterName:      rosterName,
+	}
+	path := filepath.Join(baseDir, "meta", string(rosterName), ".cache", pkgName, "cache.yml")
+	require.NoError(t, WritePackageCacheFile(path, cache))
+}
+
+// makeTarGz makes a gzip-compressed tar archive which contains the files under the 'build/' directory.
+func makeTarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(zw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "build/", Mode: 0755}))
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "build/" + name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// installTestPackage installs the package of the test roster, and fails the test if it is not installed.
+func installTestPackage(t *testing.T, roster *Roster, name string, opts ...OpOption) *InstalledVersion {
+	t.Helper()
+	st := roster.Install(name, io.Discard, nil, opts...)
+	require.NoError(t, st.Err, name)
+	require.NotNil(t, st.Installed, name)
+	return st.Installed
+}
+
+// newTestArtifactStore serves the files as the artifact store of the central roster of the test roster,
+// the names of the files are the paths in the store, e.g. 'machbase/echo/echo-1.0.0.tar.gz'.
+func newTestArtifactStore(t *testing.T, roster *Roster, files map[string][]byte) *httptest.Server {
+	t.Helper()
+	storeDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(storeDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, content, 0644))
+	}
+	store := httptest.NewServer(http.FileServer(http.Dir(storeDir)))
+	t.Cleanup(store.Close)
+	conf := "artifacts:\n  base_url: " + store.URL + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(roster.metaDir, string(ROSTER_CENTRAL), ROSTER_CONFIG_FILE), []byte(conf), 0644))
+	return store
+}
+
+// setTestLatest makes the version the latest release of the package in the cache.
+func setTestLatest(t *testing.T, roster *Roster, pkgName string, version string) {
+	t.Helper()
+	cache, err := roster.LoadPackageCache(pkgName)
+	require.NoError(t, err)
+	cache.LatestVersion = version
+	require.NoError(t, roster.WritePackageCache(cache))
+}
+
+// testMetaPath returns the path of the package.yml of the package in the central roster.
+func testMetaPath(roster *Roster, pkgName string) string {
+	return filepath.Join(roster.metaDir, string(ROSTER_CENTRAL), "projects", pkgName, "package.yml")
+}
+
+// appendTestMeta appends the yaml to the package.yml of the package in the central roster.
+func appendTestMeta(t *testing.T, roster *Roster, pkgName string, yaml string) {
+	t.Helper()
+	meta, err := os.ReadFile(testMetaPath(roster, pkgName))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(testMetaPath(roster, pkgName), append(meta, []byte(yaml)...), 0644))
+}
+
+// makeZip makes a zip archive which contains the files under the 'build/' directory.
+func makeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create("build/" + name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
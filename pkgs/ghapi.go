@@ -18,8 +18,16 @@ func GithubSplitPath(path string) (string, string, error) {
 	return toks[0], toks[1], nil
 }
 
+// githubApiUrl returns $GITHUB_API_URL, e.g. of GitHub Enterprise, or 'https://api.github.com'.
+func githubApiUrl() string {
+	if u := os.Getenv("GITHUB_API_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "https://api.github.com"
+}
+
 func GithubRepoInfo(client *http.Client, org, repo string) (*GhRepoInfo, error) {
-	endpoint := fmt.Sprintf("https://api.github.com/repos/%s/%s", org, repo)
+	endpoint := fmt.Sprintf("%s/repos/%s/%s", githubApiUrl(), org, repo)
 	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return nil, err
@@ -64,6 +72,7 @@ type GhRepoInfo struct {
 	Language        string     `json:"language" yaml:"language"`
 	License         *GhLicense `json:"license" yaml:"license"`
 	DefaultBranch   string     `json:"default_branch" yaml:"default_branch"`
+	Topics          []string   `json:"topics" yaml:"topics,omitempty"`
 }
 
 type GhLicense struct {
@@ -89,7 +98,7 @@ type GhOwner struct {
 }
 
 func GithubReleaseInfo(client *http.Client, org, repo, ver string) (*GhReleaseInfo, error) {
-	endpoint := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/tags/%s", org, repo, ver)
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s", githubApiUrl(), org, repo, ver)
 	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return nil, err
@@ -122,7 +131,7 @@ func GithubReleaseInfo(client *http.Client, org, repo, ver string) (*GhReleaseIn
 }
 
 func GithubLatestReleaseInfo(client *http.Client, org, repo string) (*GhReleaseInfo, error) {
-	endpoint := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", org, repo)
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/releases/latest", githubApiUrl(), org, repo)
 	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,100 @@
+package pkgs
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// HISTORY_FILE is the name of the journal file in the base dir.
+const HISTORY_FILE = "history.jsonl"
+
+type HistoryAction string
+
+const (
+	HISTORY_INSTALL   HistoryAction = "install"
+	HISTORY_UPGRADE   HistoryAction = "upgrade"
+	HISTORY_REINSTALL HistoryAction = "reinstall"
+	HISTORY_UNINSTALL HistoryAction = "uninstall"
+)
+
+// HistoryEntry is a line of the history journal.
+type HistoryEntry struct {
+	Time         time.Time     `json:"time"`
+	Action       HistoryAction `json:"action"`
+	PkgName      string        `json:"pkg_name"`
+	FromVersion  string        `json:"from_version,omitempty"`
+	ToVersion    string        `json:"to_version,omitempty"`
+	RosterCommit string        `json:"roster_commit,omitempty"`
+	User         string        `json:"user,omitempty"`
+	Duration     float64       `json:"duration"` // seconds
+	Success      bool          `json:"success"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// History returns the journal entries of the package in the order they were written,
+// all entries if pkgName is empty.
+func (r *Roster) History(pkgName string) ([]*HistoryEntry, error) {
+	f, err := os.Open(filepath.Join(r.baseDir, HISTORY_FILE))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	ret := []*HistoryEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry := &HistoryEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			// skip the broken line, e.g. the last line written by the crashed process
+			continue
+		}
+		if pkgName == "" || entry.PkgName == pkgName {
+			ret = append(ret, entry)
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// journal appends the entry to the history journal.
+func (r *Roster) journal(entry *HistoryEntry) {
+	if entry.User == "" {
+		entry.User = currentUser()
+	}
+	if entry.RosterCommit == "" {
+		rosterName, _ := RosterNames(entry.PkgName)
+		entry.RosterCommit = r.rosterCommit(rosterName)
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		r.log.Errorf("history: %v", err)
+		return
+	}
+	r.historyLock.Lock()
+	defer r.historyLock.Unlock()
+	f, err := os.OpenFile(filepath.Join(r.baseDir, HISTORY_FILE), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		r.log.Errorf("history: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		r.log.Errorf("history: %v", err)
+	}
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
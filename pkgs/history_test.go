@@ -0,0 +1,45 @@
+package pkgs
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+		"beta-1.0.0.tar.gz":  makeTarGz(t, map[string]string{"index.html": "beta"}),
+	})
+	entries, err := roster.History("")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	installTestPackage(t, roster, "alpha")
+	installTestPackage(t, roster, "beta")
+	installTestPackage(t, roster, "alpha")
+	require.NoError(t, roster.Uninstall("alpha", io.Discard, nil))
+	require.Error(t, roster.Install("not-exists", io.Discard, nil).Err)
+
+	entries, err = roster.History("")
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+
+	entries, err = roster.History("alpha")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, HISTORY_INSTALL, entries[0].Action)
+	require.Equal(t, "", entries[0].FromVersion)
+	require.Equal(t, "alpha-1.0.0", entries[0].ToVersion)
+	require.True(t, entries[0].Success)
+	require.Equal(t, HISTORY_REINSTALL, entries[1].Action)
+	require.Equal(t, HISTORY_UNINSTALL, entries[2].Action)
+	require.Equal(t, "alpha-1.0.0", entries[2].FromVersion)
+
+	entries, err = roster.History("not-exists")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.False(t, entries[0].Success)
+	require.Contains(t, entries[0].Error, "not found")
+}
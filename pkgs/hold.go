@@ -0,0 +1,169 @@
+package pkgs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// HOLDS_FILE is the name of the file of the held packages in the base dir.
+const HOLDS_FILE = "holds.yml"
+
+// PackageHold keeps the package from being upgraded by Update() and the bulk upgrades.
+// If the Constraint is empty, the package is held at the Version,
+// otherwise it can be upgraded to the versions which satisfy the Constraint, e.g. '~1.4'.
+type PackageHold struct {
+	PkgName    string    `yaml:"-" json:"pkg_name"`
+	Version    string    `yaml:"version,omitempty" json:"version,omitempty"`
+	Constraint string    `yaml:"constraint,omitempty" json:"constraint,omitempty"`
+	HeldAt     time.Time `yaml:"held_at" json:"held_at"`
+	User       string    `yaml:"user,omitempty" json:"user,omitempty"`
+}
+
+func (h *PackageHold) String() string {
+	if h.Constraint != "" {
+		return h.Constraint
+	}
+	return "=" + h.Version
+}
+
+// Allows reports whether the package can be upgraded to the version.
+func (h *PackageHold) Allows(version string) bool {
+	if h.Constraint == "" {
+		if cmp, err := CompareVersions(h.Version, version); err == nil {
+			return cmp == 0
+		}
+		return h.Version == version
+	}
+	c, err := semver.NewConstraint(h.Constraint)
+	if err != nil {
+		return false
+	}
+	// the package revision is not a part of the constraint
+	upstream, _ := SplitRevision(version)
+	v, err := ParseVersion(upstream)
+	if err != nil {
+		return false
+	}
+	return c.Check(v)
+}
+
+// HoldError is returned by Install if the package is held and the hold does not allow the version.
+type HoldError struct {
+	PkgName string
+	Version string
+	Hold    string
+}
+
+func (e *HoldError) Error() string {
+	return fmt.Sprintf("package %q is held by %s, %s is not allowed", e.PkgName, e.Hold, e.Version)
+}
+
+// checkHold returns the HoldError if the package is held and the hold does not allow the version.
+func (r *Roster) checkHold(pkgName string, version string) error {
+	r.holdsLock.Lock()
+	defer r.holdsLock.Unlock()
+	holds, err := r.readHolds()
+	if err != nil {
+		return err
+	}
+	if hold, ok := holds[pkgName]; ok && !hold.Allows(version) {
+		return &HoldError{PkgName: pkgName, Version: version, Hold: hold.String()}
+	}
+	return nil
+}
+
+// Hold holds the package at the installed version, or within the constraint if it is not empty.
+// The package has to be installed if the constraint is empty.
+func (r *Roster) Hold(pkgName string, constraint string) (*PackageHold, error) {
+	hold := &PackageHold{PkgName: pkgName, Constraint: constraint, HeldAt: time.Now(), User: currentUser()}
+	if constraint != "" {
+		if _, err := semver.NewConstraint(constraint); err != nil {
+			return nil, fmt.Errorf("invalid constraint %q, %w", constraint, err)
+		}
+	} else {
+		inst, err := r.InstalledVersion(pkgName)
+		if err != nil {
+			return nil, err
+		}
+		hold.Version = inst.Version
+	}
+	r.holdsLock.Lock()
+	defer r.holdsLock.Unlock()
+	holds, err := r.readHolds()
+	if err != nil {
+		return nil, err
+	}
+	holds[pkgName] = hold
+	return hold, r.writeHolds(holds)
+}
+
+// Unhold releases the package held by Hold(), it returns an error if the package is not held.
+func (r *Roster) Unhold(pkgName string) error {
+	r.holdsLock.Lock()
+	defer r.holdsLock.Unlock()
+	holds, err := r.readHolds()
+	if err != nil {
+		return err
+	}
+	if _, ok := holds[pkgName]; !ok {
+		return fmt.Errorf("package %q is not held", pkgName)
+	}
+	delete(holds, pkgName)
+	return r.writeHolds(holds)
+}
+
+// Holds returns the held packages sorted by the name.
+func (r *Roster) Holds() ([]*PackageHold, error) {
+	r.holdsLock.Lock()
+	defer r.holdsLock.Unlock()
+	holds, err := r.readHolds()
+	if err != nil {
+		return nil, err
+	}
+	ret := []*PackageHold{}
+	for _, h := range holds {
+		ret = append(ret, h)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].PkgName < ret[j].PkgName })
+	return ret, nil
+}
+
+func (r *Roster) readHolds() (map[string]*PackageHold, error) {
+	ret := map[string]*PackageHold{}
+	content, err := os.ReadFile(filepath.Join(r.baseDir, HOLDS_FILE))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(content, &ret); err != nil {
+		return nil, fmt.Errorf("invalid %s, %w", HOLDS_FILE, err)
+	}
+	if ret == nil {
+		ret = map[string]*PackageHold{}
+	}
+	for name, h := range ret {
+		h.PkgName = name
+	}
+	return ret, nil
+}
+
+func (r *Roster) writeHolds(holds map[string]*PackageHold) error {
+	content, err := yaml.Marshal(holds)
+	if err != nil {
+		return err
+	}
+	// replace the file at once, the other processes may be reading it
+	path := filepath.Join(r.baseDir, HOLDS_FILE)
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
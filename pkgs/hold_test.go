@@ -0,0 +1,83 @@
+package pkgs
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHold(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+		"bravo-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "bravo"}),
+	})
+	_, err := roster.Hold("alpha", "")
+	require.ErrorContains(t, err, `package "alpha" not installed`)
+
+	_, exitCode := roster.InstallMany([]string{"alpha", "bravo"}, 1, io.Discard, nil)
+	require.Equal(t, 0, exitCode)
+	_, err = roster.Hold("alpha", "not a constraint")
+	require.ErrorContains(t, err, `invalid constraint "not a constraint"`)
+	holds, err := roster.Holds()
+	require.NoError(t, err)
+	require.Empty(t, holds)
+
+	hold, err := roster.Hold("alpha", "")
+	require.NoError(t, err)
+	require.Equal(t, "=alpha-1.0.0", hold.String())
+	_, err = roster.Hold("bravo", "~1.4")
+	require.NoError(t, err)
+
+	// the holds are persisted in the base dir
+	roster, err = NewRoster(roster.baseDir, WithArchiveStore(nil))
+	require.NoError(t, err)
+	holds, err = roster.Holds()
+	require.NoError(t, err)
+	require.Len(t, holds, 2)
+	require.Equal(t, "alpha", holds[0].PkgName)
+	require.Equal(t, "bravo", holds[1].PkgName)
+	require.Equal(t, "~1.4", holds[1].Constraint)
+
+	pkgNames := func(list []*Upgradable) []string {
+		ret := []string{}
+		for _, u := range list {
+			ret = append(ret, u.PkgName)
+		}
+		return ret
+	}
+	setTestLatest(t, roster, "alpha", "1.0.1")
+	setTestLatest(t, roster, "bravo", "1.4.2")
+	upgradable, held, err := roster.upgradables()
+	require.NoError(t, err)
+	require.Equal(t, []string{"bravo"}, pkgNames(upgradable))
+	require.Equal(t, []string{"alpha"}, pkgNames(held))
+	require.Equal(t, "=alpha-1.0.0", held[0].Hold)
+
+	setTestLatest(t, roster, "bravo", "1.5.0")
+	upgradable, held, err = roster.upgradables()
+	require.NoError(t, err)
+	require.Empty(t, upgradable)
+	require.Equal(t, []string{"alpha", "bravo"}, pkgNames(held))
+
+	require.NoError(t, roster.Unhold("alpha"))
+	require.ErrorContains(t, roster.Unhold("alpha"), `package "alpha" is not held`)
+	upgradable, held, err = roster.upgradables()
+	require.NoError(t, err)
+	require.Equal(t, []string{"alpha"}, pkgNames(upgradable))
+	require.Equal(t, []string{"bravo"}, pkgNames(held))
+
+	// the held package is not installed beyond its hold, unless it is forced
+	st := roster.Install("bravo", io.Discard, nil)
+	holdErr := &HoldError{}
+	require.ErrorAs(t, st.Err, &holdErr)
+	require.Equal(t, "~1.4", holdErr.Hold)
+	require.Equal(t, "1.5.0", holdErr.Version)
+	inst, err := roster.InstalledVersion("bravo")
+	require.NoError(t, err)
+	require.Equal(t, "bravo-1.0.0", inst.Version)
+	installTestPackage(t, roster, "bravo", WithForce())
+	setTestLatest(t, roster, "bravo", "1.4.3")
+	installTestPackage(t, roster, "bravo")
+	installTestPackage(t, roster, "alpha")
+}
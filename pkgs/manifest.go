@@ -0,0 +1,138 @@
+package pkgs
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+)
+
+// MANIFEST_FILE is the name of the manifest file in the version directory of the installed package.
+const MANIFEST_FILE = ".neopkg-manifest.json"
+
+// InstallManifest records what the installation of a package put on disk.
+type InstallManifest struct {
+	Name            string          `json:"name"`
+	Version         string          `json:"version"`
+	SourceUrl       string          `json:"source_url"`
+	ArchiveChecksum string          `json:"archive_checksum"` // sha256 hex of the archive
+	RosterCommit    string          `json:"roster_commit,omitempty"`
+	Depends         []string        `json:"depends,omitempty"` // the depends of the package.yml at install time
+	InstalledAt     time.Time       `json:"installed_at"`
+	Files           []*ManifestFile `json:"files"`
+}
+
+// ManifestFile is a file of the installed package.
+// Path is relative to the version directory and separated by '/'.
+// Sha256 is empty for directories, Link is the target of symbolic links.
+type ManifestFile struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"`
+	Sha256 string      `json:"sha256,omitempty"`
+	Link   string      `json:"link,omitempty"`
+}
+
+// ScanManifestFiles walks the dir and returns the files sorted by path,
+// the manifest file itself is excluded.
+func ScanManifestFiles(dir string) ([]*ManifestFile, error) {
+	ret := []*ManifestFile{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == MANIFEST_FILE {
+			return nil
+		}
+		f, err := scanManifestFile(path, rel)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret, nil
+}
+
+func scanManifestFile(path string, rel string) (*ManifestFile, error) {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := &ManifestFile{Path: rel, Mode: stat.Mode()}
+	switch {
+	case stat.Mode()&fs.ModeSymlink != 0:
+		if link, err := os.Readlink(path); err != nil {
+			return nil, err
+		} else {
+			ret.Link = filepath.ToSlash(link)
+		}
+	case stat.Mode().IsRegular():
+		ret.Size = stat.Size()
+		if sum, err := FileChecksum(path); err != nil {
+			return nil, err
+		} else {
+			ret.Sha256 = sum
+		}
+	}
+	return ret, nil
+}
+
+func WriteManifestFile(path string, manifest *InstallManifest) error {
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+func ReadManifestFile(path string) (*InstallManifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := &InstallManifest{}
+	if err := json.Unmarshal(b, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Manifest returns the manifest of the installed version,
+// it returns an error if the package was installed without the manifest.
+func (inst *InstalledVersion) Manifest() (*InstallManifest, error) {
+	if inst.ManifestPath == "" {
+		return nil, os.ErrNotExist
+	}
+	return ReadManifestFile(inst.ManifestPath)
+}
+
+// rosterCommit returns the HEAD commit hash of the roster repository,
+// or empty string if the roster is not a git repository.
+func (r *Roster) rosterCommit(rosterName RosterName) string {
+	repo, err := git.PlainOpen(filepath.Join(r.metaDir, string(rosterName)))
+	if err != nil {
+		return ""
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return ""
+	}
+	return head.Hash().String()
+}
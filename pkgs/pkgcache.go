@@ -3,7 +3,9 @@ package pkgs
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -16,16 +18,20 @@ import (
 )
 
 type PackageCache struct {
-	Name             string      `yaml:"name" json:"name"`
-	Github           *GhRepoInfo `yaml:"github" json:"github"`
-	LatestVersion    string      `yaml:"latest_version" json:"latest_version"`
-	LatestRelease    string      `yaml:"latest_release" json:"latest_release"`
-	LatestReleaseTag string      `yaml:"latest_release_tag" json:"latest_release_tag"`
-	PublishedAt      time.Time   `yaml:"published_at" json:"published_at"`
-	Url              string      `yaml:"url,omitempty" json:"url,omitempty"`
-	StripComponents  int         `yaml:"strip_components" json:"strip_components"`
-	Platforms        []string    `yaml:"platforms" json:"platforms"`
-	rosterName       RosterName  `yaml:"-" json:"-"`
+	Name             string            `yaml:"name" json:"name"`
+	Github           *GhRepoInfo       `yaml:"github" json:"github"`
+	LatestVersion    string            `yaml:"latest_version" json:"latest_version"`
+	Revision         int               `yaml:"revision,omitempty" json:"revision,omitempty"`
+	LatestRelease    string            `yaml:"latest_release" json:"latest_release"`
+	LatestReleaseTag string            `yaml:"latest_release_tag" json:"latest_release_tag"`
+	PublishedAt      time.Time         `yaml:"published_at" json:"published_at"`
+	Url              string            `yaml:"url,omitempty" json:"url,omitempty"`
+	ChecksumUrl      string            `yaml:"checksum_url,omitempty" json:"checksum_url,omitempty"`
+	Checksums        map[string]string `yaml:"checksums,omitempty" json:"checksums,omitempty"`
+	StripComponents  int               `yaml:"strip_components" json:"strip_components"`
+	Platforms        []string          `yaml:"platforms" json:"platforms"`
+	rosterName       RosterName        `yaml:"-" json:"-"`
+	artifacts        *ArtifactConfig   `yaml:"-" json:"-"`
 	// this field is not saved in cache file, but includes in json api response
 	LatestReleaseSize int64  `yaml:"-" json:"latest_release_size"`
 	InstalledVersion  string `yaml:"-" json:"installed_version"`
@@ -33,6 +39,23 @@ type PackageCache struct {
 	InstalledFrontend bool   `yaml:"-" json:"installed_frontend"`
 	InstalledBackend  bool   `yaml:"-" json:"installed_backend"`
 	WorkInProgress    bool   `yaml:"-" json:"work_in_progress"`
+	// the matched words of the fields by SearchPackage(), for highlighting
+	Matched map[SearchField][]string `yaml:"-" json:"matched,omitempty"`
+}
+
+// FullName returns the name of the package which is prefixed with the roster name
+// if the package is not of the central roster, e.g. 'myroster/mypkg'.
+func (cache *PackageCache) FullName() string {
+	if cache.rosterName == "" || cache.rosterName == ROSTER_CENTRAL {
+		return cache.Name
+	}
+	return fmt.Sprintf("%s/%s", cache.rosterName, cache.Name)
+}
+
+// Version returns the latest version with the package revision, e.g. '1.2.3-r2'.
+// It is the name of the version directory of the installed package.
+func (cache *PackageCache) Version() string {
+	return RevisionVersion(cache.LatestVersion, cache.Revision)
 }
 
 func (cache *PackageCache) Support(platformOS string, platformArch string) bool {
@@ -76,12 +99,23 @@ func (cache *PackageCache) RemoteDistribution() ([]*PackageDistribution, error)
 		if cache.Url != "" {
 			// from direct url
 			pd.Url = cache.Url
+			pd.ChecksumUrl = cache.ChecksumUrl
+			pd.Checksum = cache.checksum(platform)
 			pd.ArchiveBase = filepath.Base(cache.Url)
-			pd.ArchiveExt = filepath.Ext(pd.ArchiveBase)
-			pd.UnarchiveDir = strings.TrimSuffix(pd.ArchiveBase, pd.ArchiveExt)
+			if u, err := url.Parse(cache.Url); err == nil && u.Path != "" {
+				pd.ArchiveBase = path.Base(u.Path)
+			}
+			pd.ArchiveExt = ArchiveExt(pd.ArchiveBase)
+			if pd.ArchiveExt != "" {
+				pd.UnarchiveDir = strings.TrimSuffix(pd.ArchiveBase, pd.ArchiveExt)
+			} else {
+				// single binary, or an archive which will be detected by its content
+				pd.UnarchiveDir = cache.LatestVersion
+			}
+			pd.UnarchiveDir = RevisionName(pd.UnarchiveDir, cache.LatestVersion, cache.Revision)
 		} else {
-			// from s3
-			releaseFilename := cache.LatestVersion
+			// from the artifact store of the roster
+			releaseFilename := cache.Version()
 			if platformOS != "" && platformArch != "" {
 				pd.ArchiveBase = fmt.Sprintf("%s-%s-%s-%s.tar.gz", cache.Github.Repo, releaseFilename, platformOS, platformArch)
 			} else {
@@ -90,18 +124,35 @@ func (cache *PackageCache) RemoteDistribution() ([]*PackageDistribution, error)
 			pd.ArchiveExt = ".tar.gz"
 			pd.UnarchiveDir = releaseFilename
 
-			bucket := "p-edge-packages"
-			region := "ap-northeast-2"
-			pd.Url = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/neo-pkg/%s/%s/%s",
-				bucket, region,
-				cache.Github.Organization, cache.Github.Repo, pd.ArchiveBase)
-
+			artifacts := cache.artifacts
+			if artifacts == nil {
+				artifacts = DefaultArtifactConfig()
+			}
+			if u, err := artifacts.DownloadUrl(cache.Github.Organization, cache.Github.Repo, pd.ArchiveBase, map[string]string{
+				"version": releaseFilename,
+				"os":      platformOS,
+				"arch":    platformArch,
+			}); err != nil {
+				return nil, err
+			} else {
+				pd.Url = u
+			}
+			pd.ChecksumUrl = pd.Url + ".sum"
 		}
 		ret = append(ret, pd)
 	}
 	return ret, nil
 }
 
+// checksum returns the inline checksum of the given platform ("os/arch"),
+// if there is no checksum for the platform, it returns the checksum for '*'.
+func (cache *PackageCache) checksum(platform string) string {
+	if sum, ok := cache.Checksums[platform]; ok {
+		return sum
+	}
+	return cache.Checksums["*"]
+}
+
 type InstalledVersion struct {
 	Name           string `yaml:"name" json:"name"`
 	Version        string `yaml:"version" json:"version"`
@@ -110,25 +161,31 @@ type InstalledVersion struct {
 	HasBackend     bool   `yaml:"has_backend" json:"has_backend"`
 	HasFrontend    bool   `yaml:"has_frontend" json:"has_frontend"`
 	WorkInProgress bool   `yaml:"work_in_progress" json:"work_in_progress"`
+	ManifestPath   string `yaml:"manifest_path,omitempty" json:"manifest_path,omitempty"`
+	WorkPhase      string `yaml:"work_phase,omitempty" json:"work_phase,omitempty"`
+	WorkAge        int64  `yaml:"work_age,omitempty" json:"work_age,omitempty"` // seconds
+	WorkStale      bool   `yaml:"work_stale,omitempty" json:"work_stale,omitempty"`
 }
 
 func (roster *Roster) InstalledVersion(pkgName string) (*InstalledVersion, error) {
-	rosterName, name := RosterNames(pkgName)
-	var thisPkgDir string
-	if rosterName == ROSTER_CENTRAL {
-		thisPkgDir = filepath.Join(roster.distDir, name)
-	} else {
-		thisPkgDir = filepath.Join(roster.distDir, string(rosterName), name)
-	}
-	wip := false
-	if _, err := os.Stat(filepath.Join(thisPkgDir, "wip")); err == nil {
-		wip = true
+	thisPkgDir := roster.pkgDir(pkgName)
+	// the stale marker of the killed process is not a work in progress
+	wip, stale := false, false
+	marker, err := ReadWorkMarker(filepath.Join(thisPkgDir, "wip"))
+	if err == nil {
+		stale = marker.Stale(roster.workTimeout)
+		wip = !stale
 	}
 	currentVerDir := filepath.Join(thisPkgDir, "current")
 	if _, err := os.Stat(currentVerDir); err == nil {
 		ret := &InstalledVersion{
 			Name:           pkgName,
 			WorkInProgress: wip,
+			WorkStale:      stale,
+		}
+		if marker != nil {
+			ret.WorkPhase = string(marker.Phase)
+			ret.WorkAge = int64(marker.Age().Seconds())
 		}
 		ret.CurrentPath = currentVerDir
 		current, err := Readlink(currentVerDir)
@@ -144,6 +201,9 @@ func (roster *Roster) InstalledVersion(pkgName string) (*InstalledVersion, error
 		if _, err := os.Stat(filepath.Join(ret.Path, "index.html")); err == nil {
 			ret.HasFrontend = true
 		}
+		if _, err := os.Stat(filepath.Join(ret.Path, MANIFEST_FILE)); err == nil {
+			ret.ManifestPath = filepath.Join(ret.Path, MANIFEST_FILE)
+		}
 		return ret, nil
 	} else {
 		return nil, fmt.Errorf("package %q not installed, %w", pkgName, err)
@@ -163,8 +223,14 @@ func (roster *Roster) UpdatePackageCache(meta *PackageMeta) (*PackageCache, erro
 	cache := &PackageCache{
 		Name:       meta.pkgName,
 		Platforms:  meta.Platforms,
+		Revision:   meta.Revision,
 		rosterName: meta.rosterName,
 	}
+	if conf, err := roster.LoadRosterConfig(meta.rosterName); err != nil {
+		return nil, err
+	} else {
+		cache.artifacts = conf.Artifacts
+	}
 	org, repo, err := GithubSplitPath(meta.Distributable.Github)
 	if err != nil {
 		return nil, err
@@ -205,24 +271,39 @@ func (roster *Roster) UpdatePackageCache(meta *PackageMeta) (*PackageCache, erro
 	}
 
 	if meta.Distributable.Url != "" {
-		tmpl, err := template.New("url").Parse(meta.Distributable.Url)
-		if err != nil {
-			return cache, err
-		}
-		buff := &strings.Builder{}
 		version := strings.TrimPrefix(ghRelease.TagName, "v")
 		version = strings.TrimPrefix(version, "V")
-		tmpl.Execute(buff, map[string]string{
+		vars := map[string]string{
 			"tag":     ghRelease.TagName,
 			"version": version,
 			"os":      runtime.GOOS,
 			"arch":    runtime.GOARCH,
-		})
-		cache.Url = buff.String()
+		}
+		if cache.Url, err = renderUrlTemplate(meta.Distributable.Url, vars); err != nil {
+			return cache, err
+		}
+		if meta.Distributable.ChecksumUrl != "" {
+			if cache.ChecksumUrl, err = renderUrlTemplate(meta.Distributable.ChecksumUrl, vars); err != nil {
+				return cache, err
+			}
+		}
+		cache.Checksums = meta.Distributable.Checksums
 	}
 	return cache, err
 }
 
+func renderUrlTemplate(text string, vars map[string]string) (string, error) {
+	tmpl, err := template.New("url").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buff := &strings.Builder{}
+	if err := tmpl.Execute(buff, vars); err != nil {
+		return "", err
+	}
+	return buff.String(), nil
+}
+
 func (roster *Roster) LoadPackageCache(pkgName string) (*PackageCache, error) {
 	var rosterName = ROSTER_CENTRAL
 	rosterName, pkgName = RosterNames(pkgName)
@@ -239,8 +320,13 @@ func ReadPackageCacheFile(path string) (*PackageCache, error) {
 	if err := yaml.Unmarshal(content, ret); err != nil {
 		return nil, err
 	}
-	rosterName := filepath.Base(filepath.Dir(filepath.Dir(path)))
-	ret.rosterName = RosterName(rosterName)
+	rosterDir := RosterDirOf(path)
+	ret.rosterName = RosterName(filepath.Base(rosterDir))
+	if conf, err := LoadRosterConfigFile(rosterDir); err != nil {
+		return nil, err
+	} else {
+		ret.artifacts = conf.Artifacts
+	}
 	return ret, nil
 }
 
@@ -302,6 +388,8 @@ type PackageDistribution struct {
 	PlatformOS      string     `json:"platform_os"`
 	PlatformArch    string     `json:"platform_arch"`
 	Url             string     `json:"url"`
+	ChecksumUrl     string     `json:"checksum_url,omitempty"`
+	Checksum        string     `json:"checksum,omitempty"`
 	ArchiveBase     string     `json:"archive_base"`
 	ArchiveExt      string     `json:"archive_ext"`
 	UnarchiveDir    string     `json:"unarchive_base"`
@@ -0,0 +1,243 @@
+package pkgs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+type DoctorIssue string
+
+const (
+	ISSUE_STALE_WIP      DoctorIssue = "stale-wip"      // 'wip' marker left by an interrupted install
+	ISSUE_DANGLING_LINK  DoctorIssue = "dangling-link"  // 'current' link to a removed version
+	ISSUE_ORPHAN_ARCHIVE DoctorIssue = "orphan-archive" // downloaded archive left in the package dir
+	ISSUE_MISSING_CACHE  DoctorIssue = "missing-cache"  // package.yml without cache.yml
+	ISSUE_MISSING_META   DoctorIssue = "missing-meta"   // cache.yml or installed package without package.yml
+)
+
+// DoctorFinding is a broken state found by Doctor().
+type DoctorFinding struct {
+	PkgName string      `json:"pkg_name"`
+	Issue   DoctorIssue `json:"issue"`
+	Path    string      `json:"path"`
+	Fixed   bool        `json:"fixed"`
+	FixErr  error       `json:"fix_error,omitempty"`
+}
+
+func (f *DoctorFinding) String() string {
+	return fmt.Sprintf("%s %s %s", f.PkgName, f.Issue, f.Path)
+}
+
+// Doctor finds the broken states of the base dir which are left by the crashed installs
+// or the partial roster updates. If fix is true, it repairs them:
+//   - stale wip: removes the marker
+//   - dangling current link: relinks to the only version dir which has the install manifest, or removes the link
+//   - orphan archive: removes the downloaded archive, the other files in the package dir are left
+//   - missing cache: rebuilds the cache from the package.yml
+//   - missing meta: re-syncs the roster, and removes the cache entry which is still without package.yml
+//
+// The packages which are being installed by the live processes are skipped.
+func (r *Roster) Doctor(fix bool) ([]*DoctorFinding, error) {
+	ret := []*DoctorFinding{}
+	if found, err := r.doctorDist(); err != nil {
+		return nil, err
+	} else {
+		ret = append(ret, found...)
+	}
+	if found, err := r.doctorMeta(); err != nil {
+		return nil, err
+	} else {
+		ret = append(ret, found...)
+	}
+	if !fix {
+		return ret, nil
+	}
+	synced := map[RosterName]bool{}
+	for _, f := range ret {
+		f.FixErr = r.doctorFix(f, synced)
+		f.Fixed = f.FixErr == nil
+	}
+	return ret, nil
+}
+
+func (r *Roster) doctorDist() ([]*DoctorFinding, error) {
+	ret := []*DoctorFinding{}
+	var walkErr error
+	err := r.walkPkgDirs(func(name string, pkgDir string) {
+		if walkErr != nil {
+			return
+		}
+		found, err := r.doctorPkgDir(name, pkgDir)
+		if err != nil {
+			walkErr = err
+			return
+		}
+		ret = append(ret, found...)
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return ret, walkErr
+}
+
+func (r *Roster) doctorPkgDir(name string, pkgDir string) ([]*DoctorFinding, error) {
+	ret := []*DoctorFinding{}
+	files, err := os.ReadDir(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+	if marker, err := ReadWorkMarker(filepath.Join(pkgDir, "wip")); err == nil && !marker.Stale(r.workTimeout) {
+		// being installed
+		return ret, nil
+	}
+	archives := r.archiveNames(name)
+	for _, file := range files {
+		path := filepath.Join(pkgDir, file.Name())
+		switch file.Name() {
+		case "wip":
+			ret = append(ret, &DoctorFinding{PkgName: name, Issue: ISSUE_STALE_WIP, Path: path})
+		case "current":
+			if _, err := os.Stat(path); err != nil {
+				ret = append(ret, &DoctorFinding{PkgName: name, Issue: ISSUE_DANGLING_LINK, Path: path})
+			}
+		default:
+			// the other files may be made by the user, leave them
+			if file.Type().IsRegular() && (ArchiveExt(file.Name()) != "" || slices.Contains(archives, file.Name())) {
+				ret = append(ret, &DoctorFinding{PkgName: name, Issue: ISSUE_ORPHAN_ARCHIVE, Path: path})
+			}
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(pkgDir, "current")); err != nil {
+		// not installed
+		return ret, nil
+	}
+	if meta, err := r.LoadPackageMeta(name); err == nil && meta == nil {
+		ret = append(ret, &DoctorFinding{PkgName: name, Issue: ISSUE_MISSING_META, Path: pkgDir})
+	}
+	return ret, nil
+}
+
+// archiveNames returns the names of the files which the install of the package downloads into the package dir,
+// e.g. the single binary distributions which have no archive extension.
+func (r *Roster) archiveNames(name string) []string {
+	cache, err := r.LoadPackageCache(name)
+	if err != nil {
+		return nil
+	}
+	dists, _ := cache.RemoteDistribution()
+	ret := []string{}
+	for _, d := range dists {
+		ret = append(ret, d.ArchiveBase)
+	}
+	return ret
+}
+
+// doctorMeta finds the missing meta before the missing cache,
+// so that the fix syncs the roster before rebuilding the caches, the sync may bring the caches.
+func (r *Roster) doctorMeta() ([]*DoctorFinding, error) {
+	ret := []*DoctorFinding{}
+	r.WalkPackageCache(func(name string) bool {
+		rosterName, pkgName := RosterNames(name)
+		if meta, err := r.LoadPackageMetaRoster(rosterName, pkgName); err == nil && meta == nil {
+			cacheDir := filepath.Join(r.metaDir, string(rosterName), ".cache", pkgName)
+			ret = append(ret, &DoctorFinding{PkgName: name, Issue: ISSUE_MISSING_META, Path: cacheDir})
+		}
+		return true
+	})
+	r.WalkPackageMeta(func(name string) bool {
+		rosterName, pkgName := RosterNames(name)
+		cachePath := filepath.Join(r.metaDir, string(rosterName), ".cache", pkgName, "cache.yml")
+		if _, err := os.Stat(cachePath); err != nil {
+			ret = append(ret, &DoctorFinding{PkgName: name, Issue: ISSUE_MISSING_CACHE, Path: cachePath})
+		}
+		return true
+	})
+	return ret, nil
+}
+
+func (r *Roster) doctorFix(f *DoctorFinding, synced map[RosterName]bool) error {
+	switch f.Issue {
+	case ISSUE_STALE_WIP, ISSUE_ORPHAN_ARCHIVE:
+		return os.Remove(f.Path)
+	case ISSUE_DANGLING_LINK:
+		if err := os.Remove(f.Path); err != nil {
+			return err
+		}
+		dirs, err := versionDirs(filepath.Dir(f.Path))
+		if err != nil {
+			return err
+		}
+		// the dirs left by Uninstall with the data and config dirs have no manifest
+		versions := slices.DeleteFunc(dirs, func(dir string) bool {
+			_, err := os.Stat(filepath.Join(dir, MANIFEST_FILE))
+			return err != nil
+		})
+		if len(versions) != 1 {
+			// no installed version, or can not decide which version to link
+			return nil
+		}
+		oldName, _ := filepath.Abs(versions[0])
+		return Symlink(oldName, f.Path)
+	case ISSUE_MISSING_CACHE:
+		if _, err := os.Stat(f.Path); err == nil {
+			// brought by the sync
+			return nil
+		}
+		meta, err := r.LoadPackageMeta(f.PkgName)
+		if err != nil {
+			return err
+		}
+		if meta == nil {
+			return fmt.Errorf("package %q not found", f.PkgName)
+		}
+		cache, err := r.UpdatePackageCache(meta)
+		if err != nil {
+			return err
+		}
+		return r.WritePackageCache(cache)
+	case ISSUE_MISSING_META:
+		rosterName, pkgName := RosterNames(f.PkgName)
+		if !synced[rosterName] {
+			synced[rosterName] = true
+			if repoUrl, ok := r.rosterRepos[rosterName]; ok {
+				if err := r.Sync(rosterName, repoUrl); err != nil {
+					return err
+				}
+			}
+		}
+		if meta, err := r.LoadPackageMetaRoster(rosterName, pkgName); err != nil {
+			return err
+		} else if meta != nil {
+			return nil
+		}
+		if filepath.Base(filepath.Dir(f.Path)) == ".cache" {
+			// the package was removed from the roster
+			return os.RemoveAll(f.Path)
+		}
+		return fmt.Errorf("package %q is not in the roster %q", pkgName, rosterName)
+	}
+	return fmt.Errorf("unknown issue %q", f.Issue)
+}
+
+// versionDirs returns the version directories in the package dir.
+func versionDirs(pkgDir string) ([]string, error) {
+	entries, err := os.ReadDir(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, entry := range entries {
+		// the package dirs of the roster of the same name as the package are not its versions
+		if entry.IsDir() && entry.Name() != "logs" && !isPkgDir(filepath.Join(pkgDir, entry.Name())) {
+			ret = append(ret, filepath.Join(pkgDir, entry.Name()))
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
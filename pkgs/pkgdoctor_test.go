@@ -0,0 +1,195 @@
+package pkgs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoctor(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+	})
+	st := roster.Install("alpha", io.Discard, nil)
+	require.NoError(t, st.Err)
+
+	found, err := roster.Doctor(false)
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	// break the installation
+	pkgDir := filepath.Join(roster.distDir, "alpha")
+	marker := &WorkMarker{Pid: os.Getpid(), StartedAt: time.Now(), Phase: PHASE_DOWNLOAD}
+	require.NoError(t, WriteWorkMarker(filepath.Join(pkgDir, "wip"), marker))
+	found, err = roster.Doctor(false)
+	require.NoError(t, err)
+	require.Empty(t, found, "install in progress")
+	marker.StartedAt = time.Now().Add(-2 * DEFAULT_WORK_TIMEOUT)
+	require.NoError(t, WriteWorkMarker(filepath.Join(pkgDir, "wip"), marker))
+	require.NoError(t, os.WriteFile(filepath.Join(pkgDir, "alpha-1.0.0.tar.gz"), []byte("partial"), 0644))
+	require.NoError(t, os.Rename(st.Installed.Path, filepath.Join(pkgDir, "1.0.1")))
+	// not an archive, it is not touched
+	notes := filepath.Join(pkgDir, "notes.txt")
+	require.NoError(t, os.WriteFile(notes, []byte("my notes"), 0644))
+	// the data left by the uninstall of the other version is not an installed version
+	require.NoError(t, os.MkdirAll(filepath.Join(pkgDir, "0.9.0", "data"), 0755))
+
+	found, err = roster.Doctor(false)
+	require.NoError(t, err)
+	issues := map[DoctorIssue]string{}
+	for _, f := range found {
+		issues[f.Issue] = f.PkgName
+	}
+	require.Equal(t, map[DoctorIssue]string{
+		ISSUE_STALE_WIP:      "alpha",
+		ISSUE_DANGLING_LINK:  "alpha",
+		ISSUE_ORPHAN_ARCHIVE: "alpha",
+	}, issues)
+
+	found, err = roster.Doctor(true)
+	require.NoError(t, err)
+	require.Len(t, found, 3)
+	for _, f := range found {
+		require.True(t, f.Fixed, f.String())
+	}
+	inst, err := roster.InstalledVersion("alpha")
+	require.NoError(t, err)
+	require.Equal(t, "1.0.1", inst.Version)
+	require.False(t, inst.WorkInProgress)
+	content, err := os.ReadFile(notes)
+	require.NoError(t, err)
+	require.Equal(t, "my notes", string(content))
+
+	found, err = roster.Doctor(false)
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	// no installed version to link
+	require.NoError(t, os.Remove(filepath.Join(inst.Path, MANIFEST_FILE)))
+	require.NoError(t, os.Rename(inst.Path, filepath.Join(pkgDir, "1.0.2")))
+	found, err = roster.Doctor(true)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, ISSUE_DANGLING_LINK, found[0].Issue)
+	_, err = os.Lstat(filepath.Join(pkgDir, "current"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestDoctorRoster(t *testing.T) {
+	base, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+	})
+	rosterDir := filepath.Join(base.metaDir, string(ROSTER_CENTRAL))
+	// 'phantom' was removed from the roster but its cache was not,
+	// and 'bravo' was added to the roster but its cache was not built yet
+	writeTestPackage(t, base.baseDir, ROSTER_CENTRAL, "phantom", "")
+	require.NoError(t, os.RemoveAll(filepath.Join(rosterDir, "projects", "phantom")))
+	writeTestPackage(t, base.baseDir, ROSTER_CENTRAL, "bravo", "")
+	require.NoError(t, os.RemoveAll(filepath.Join(rosterDir, ".cache", "bravo")))
+	remoteDir := newTestRosterRemote(t, rosterDir)
+
+	// the remote has 'ghost', and only its cache is pulled
+	ghost := &PackageCache{Name: "ghost", Github: &GhRepoInfo{Organization: "machbase", Repo: "ghost"}, LatestVersion: "1.0.0"}
+	for _, dir := range []string{remoteDir, rosterDir} {
+		require.NoError(t, WritePackageCacheFile(filepath.Join(dir, ".cache", "ghost", "cache.yml"), ghost))
+	}
+	ghostMeta := filepath.Join(remoteDir, "projects", "ghost", "package.yml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(ghostMeta), 0755))
+	require.NoError(t, os.WriteFile(ghostMeta, []byte("distributable:\n  github: machbase/ghost\n"), 0644))
+	commitTestRoster(t, remoteDir)
+
+	roster, err := NewRoster(base.baseDir, WithArchiveStore(nil), WithRosterRepo(ROSTER_CENTRAL, remoteDir))
+	require.NoError(t, err)
+
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/machbase/bravo":
+			w.Write([]byte(`{"name":"bravo","full_name":"machbase/bravo","description":"bravo package"}`))
+		case "/repos/machbase/bravo/releases/latest":
+			w.Write([]byte(`{"name":"v1.2.0","tag_name":"v1.2.0","published_at":"2024-07-29T05:17:51Z",` +
+				`"html_url":"","tarball_url":"","prerelease":false}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(github.Close)
+	t.Setenv("GITHUB_API_URL", github.URL)
+
+	found, err := roster.Doctor(false)
+	require.NoError(t, err)
+	issues := map[string]DoctorIssue{}
+	for _, f := range found {
+		issues[f.PkgName] = f.Issue
+	}
+	require.Equal(t, map[string]DoctorIssue{
+		"bravo":   ISSUE_MISSING_CACHE,
+		"ghost":   ISSUE_MISSING_META,
+		"phantom": ISSUE_MISSING_META,
+	}, issues)
+
+	found, err = roster.Doctor(true)
+	require.NoError(t, err)
+	require.Len(t, found, 3)
+	for _, f := range found {
+		require.True(t, f.Fixed, f.String())
+	}
+	// the cache is rebuilt from the package.yml
+	cache, err := roster.LoadPackageCache("bravo")
+	require.NoError(t, err)
+	require.Equal(t, "1.2.0", cache.LatestVersion)
+	require.Equal(t, "bravo package", cache.Github.Description)
+	// the roster is pulled
+	meta, err := roster.LoadPackageMeta("ghost")
+	require.NoError(t, err)
+	require.NotNil(t, meta)
+	_, err = roster.LoadPackageCache("ghost")
+	require.NoError(t, err)
+	// the cache of the removed package is removed
+	_, err = os.Stat(filepath.Join(rosterDir, ".cache", "phantom"))
+	require.True(t, os.IsNotExist(err))
+
+	found, err = roster.Doctor(false)
+	require.NoError(t, err)
+	require.Empty(t, found)
+}
+
+// newTestRosterRemote makes the roster dir a git repository on 'main',
+// and returns the clone of it which is the 'origin' of the roster dir.
+func newTestRosterRemote(t *testing.T, rosterDir string) string {
+	t.Helper()
+	repo, err := git.PlainInitWithOptions(rosterDir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	require.NoError(t, err)
+	commitTestRoster(t, rosterDir)
+	remoteDir := t.TempDir()
+	_, err = git.PlainClone(remoteDir, false, &git.CloneOptions{URL: rosterDir})
+	require.NoError(t, err)
+	_, err = repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{remoteDir}})
+	require.NoError(t, err)
+	return remoteDir
+}
+
+// commitTestRoster commits all files of the roster repository.
+func commitTestRoster(t *testing.T, dir string) {
+	t.Helper()
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.AddWithOptions(&git.AddOptions{All: true}))
+	_, err = w.Commit("update", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+}
@@ -1,19 +1,23 @@
 package pkgs
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/machbase/neo-pkgdev/pkgs/untar"
+	"github.com/machbase/neo-pkgdev/pkgs/unzip"
 )
 
 type InstallStatus struct {
@@ -22,9 +26,39 @@ type InstallStatus struct {
 	Installed *InstalledVersion `json:"installed,omitempty"`
 }
 
-func (r *Roster) Install(name string, output io.Writer, env []string) *InstallStatus {
+func (r *Roster) Install(name string, output io.Writer, env []string, opts ...OpOption) *InstallStatus {
+	return r.install(context.Background(), name, output, env, makeOpOptions(opts))
+}
+
+// InstallContext is Install with the ctx which cancels the download and the install script.
+func (r *Roster) InstallContext(ctx context.Context, name string, output io.Writer, env []string, opts ...OpOption) *InstallStatus {
+	return r.install(ctx, name, output, env, makeOpOptions(opts))
+}
+
+// InstallArchive installs the package from the local archive file instead of downloading it,
+// e.g. on the devices which have no internet connection.
+// The archive is verified with the checksum given by WithChecksum(), or the checksum file
+// next to the archive ('<archive>.sum', '<archive>.sha256' or 'SHA256SUMS'),
+// or the checksum of the package.yml, it fails if none of them is available.
+func (r *Roster) InstallArchive(name string, archivePath string, output io.Writer, env []string, opts ...OpOption) *InstallStatus {
+	return r.InstallArchiveContext(context.Background(), name, archivePath, output, env, opts...)
+}
+
+func (r *Roster) InstallArchiveContext(ctx context.Context, name string, archivePath string, output io.Writer, env []string, opts ...OpOption) *InstallStatus {
+	o := makeOpOptions(opts)
+	o.archivePath = archivePath
+	return r.install(ctx, name, output, env, o)
+}
+
+func (r *Roster) install(ctx context.Context, name string, output io.Writer, env []string, opts *opOptions) *InstallStatus {
 	var ret *InstallStatus
-	if err := r.install0(name, output, env); err != nil {
+	entry := &HistoryEntry{Time: time.Now(), Action: HISTORY_INSTALL, PkgName: name}
+	if inst, err := r.InstalledVersion(name); err == nil {
+		entry.FromVersion = inst.Version
+	}
+	opts.emit(&Event{Type: EVENT_STARTED, Op: "install", PkgName: name})
+	output, flush := opts.output("install", name, output)
+	if err := r.install0(ctx, name, output, env, opts); err != nil {
 		ret = &InstallStatus{
 			PkgName: name,
 			Err:     err,
@@ -37,22 +71,162 @@ func (r *Roster) Install(name string, output io.Writer, env []string) *InstallSt
 			Installed: inst,
 		}
 	}
+	if ret.Installed != nil {
+		entry.ToVersion = ret.Installed.Version
+		if entry.FromVersion == entry.ToVersion {
+			entry.Action = HISTORY_REINSTALL
+		} else if entry.FromVersion != "" {
+			entry.Action = HISTORY_UPGRADE
+		}
+	}
+	flush()
+	opts.emitResult("install", name, ret, ret.Err)
+	entry.Duration = time.Since(entry.Time).Seconds()
+	entry.Success = ret.Err == nil
+	if ret.Err != nil {
+		entry.Error = ret.Err.Error()
+	}
+	r.journal(entry)
 	return ret
 }
 
+// InstallMany installs the packages, downloading up to 'workers' packages in parallel.
+// Extracting archives and running install scripts are serialized,
+// so that the install scripts of the packages do not interfere with each other.
+// The output of each package is prefixed with its name.
+// It returns the status of each package in the order of names, and the exit code
+// which is 0 if all packages are installed, 2 if all packages are failed, otherwise 1.
+func (r *Roster) InstallMany(names []string, workers int, output io.Writer, env []string, opts ...OpOption) ([]*InstallStatus, int) {
+	return r.InstallManyContext(context.Background(), names, workers, output, env, opts...)
+}
+
+// InstallManyContext is InstallMany with the ctx, the packages which are not started yet
+// when the ctx is done fail with the error of the ctx.
+func (r *Roster) InstallManyContext(ctx context.Context, names []string, workers int, output io.Writer, env []string, opts ...OpOption) ([]*InstallStatus, int) {
+	if workers <= 0 {
+		workers = 1
+	}
+	uniqNames := []string{}
+	for _, name := range names {
+		if !slices.Contains(uniqNames, name) {
+			uniqNames = append(uniqNames, name)
+		}
+	}
+	o := makeOpOptions(opts)
+	ret := make([]*InstallStatus, len(uniqNames))
+	out := &syncWriter{w: output}
+	jobCh := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers && w < len(uniqNames); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobCh {
+				name := uniqNames[idx]
+				if err := ctx.Err(); err != nil {
+					ret[idx] = &InstallStatus{PkgName: name, Err: err}
+					continue
+				}
+				pw := &prefixWriter{prefix: name + ": ", w: out}
+				ret[idx] = r.install(ctx, name, pw, env, o)
+				pw.Flush()
+			}
+		}()
+	}
+	for idx := range uniqNames {
+		jobCh <- idx
+	}
+	close(jobCh)
+	wg.Wait()
+
+	failed := 0
+	for _, st := range ret {
+		if st.Err != nil || st.Installed == nil {
+			failed++
+		}
+	}
+	exitCode := 0
+	if failed > 0 && failed == len(ret) {
+		exitCode = 2
+	} else if failed > 0 {
+		exitCode = 1
+	}
+	return ret, exitCode
+}
+
 // Install installs the package to the distDir
 // returns the installed symlink path '~/dist/<name>/current'
-func (r *Roster) install0(name string, output io.Writer, env []string) error {
-	meta, err := r.LoadPackageMeta(name)
+func (r *Roster) install0(ctx context.Context, name string, output io.Writer, env []string, opts *opOptions) error {
+	job, err := r.prepareInstall(name, opts)
 	if err != nil {
 		return err
 	}
-	cache, err := r.LoadPackageCache(name)
+	defer job.done()
+	if opts.archivePath != "" {
+		err = r.localArchiveInstall(job, opts.archivePath, output, opts)
+	} else {
+		err = r.downloadInstall(ctx, job, output, opts)
+	}
 	if err != nil {
 		return err
 	}
+	r.applyLock.Lock()
+	defer r.applyLock.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.applyInstall(ctx, job, output, env, opts)
+}
+
+// installJob holds the state of a package while it is being installed.
+type installJob struct {
+	name          string
+	meta          *PackageMeta
+	cache         *PackageCache
+	dist          *PackageDistribution
+	archiveFile   string
+	archiveExt    string
+	keepArchive   bool   // do not remove the archiveFile after install
+	sourceUrl     string // where the archive came from
+	checksum      string // sha256 hex of the archive
+	unarchiveDir  string
+	currentVerDir string
+	wip           string // work in progress
+	marker        *WorkMarker
+}
+
+func (job *installJob) done() {
+	os.Remove(job.wip)
+}
+
+// reportPhase records the phase into the wip marker and reports it to the observer.
+func (job *installJob) reportPhase(opts *opOptions, phase InstallPhase) {
+	job.marker.Phase = phase
+	WriteWorkMarker(job.wip, job.marker)
+	opts.reportPhase(job.name, phase)
+}
+
+// prepareInstall resolves the distribution of the package for this platform
+// and makes the directory for the new version.
+func (r *Roster) prepareInstall(name string, opts *opOptions) (*installJob, error) {
+	opts.reportPhase(name, PHASE_RESOLVE)
+	meta, err := r.LoadPackageMeta(name)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("package %q not found", name)
+	}
+	cache, err := r.LoadPackageCache(name)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.force {
+		if err := r.checkHold(name, cache.Version()); err != nil {
+			return nil, err
+		}
+	}
 
-	force := true
 	distAvailable, _ := cache.RemoteDistribution()
 	var dist *PackageDistribution
 	for _, d := range distAvailable {
@@ -66,24 +240,34 @@ func (r *Roster) install0(name string, output io.Writer, env []string) error {
 		}
 	}
 	if dist == nil {
-		return fmt.Errorf("no distribution for %s/%s", runtime.GOOS, runtime.GOARCH)
+		return nil, fmt.Errorf("no distribution for %s/%s", runtime.GOOS, runtime.GOARCH)
 	}
 
-	thisPkgDir := filepath.Join(r.distDir, cache.Name)
-	archiveFile := filepath.Join(thisPkgDir, dist.ArchiveBase)
-	unarchiveDir := filepath.Join(thisPkgDir, dist.UnarchiveDir)
-	currentVerDir := filepath.Join(thisPkgDir, "current")
-	wip := filepath.Join(thisPkgDir, "wip") // work in progress
-
-	if err := os.MkdirAll(unarchiveDir, 0755); err != nil {
-		if !os.IsExist(err) {
-			return err
-		}
+	thisPkgDir := r.pkgDir(name)
+	job := &installJob{
+		name:          name,
+		meta:          meta,
+		cache:         cache,
+		dist:          dist,
+		archiveFile:   filepath.Join(thisPkgDir, dist.ArchiveBase),
+		archiveExt:    dist.ArchiveExt,
+		unarchiveDir:  filepath.Join(thisPkgDir, dist.UnarchiveDir),
+		currentVerDir: filepath.Join(thisPkgDir, "current"),
+		wip:           filepath.Join(thisPkgDir, "wip"),
+		marker:        newWorkMarker(dist.Url),
 	}
 
-	if _, err := os.Stat(archiveFile); err == nil && !force {
-		return fmt.Errorf("file %q already exists", archiveFile)
+	if err := os.MkdirAll(thisPkgDir, 0755); err != nil {
+		return nil, err
 	}
+	WriteWorkMarker(job.wip, job.marker)
+	return job, nil
+}
+
+// downloadInstall downloads the archive file of the job and verifies its checksum.
+func (r *Roster) downloadInstall(ctx context.Context, job *installJob, output io.Writer, opts *opOptions) error {
+	name, cache, dist := job.name, job.cache, job.dist
+	archiveFile := job.archiveFile
 
 	var srcUrl, sumUrl *url.URL
 	if cache.Url != "" {
@@ -98,13 +282,14 @@ func (r *Roster) install0(name string, output io.Writer, env []string) error {
 		} else {
 			srcUrl = u
 		}
-		sumUrl, _ = url.Parse(dist.Url + ".sum")
 	}
-
-	os.WriteFile(wip, []byte(dist.Url), 0644)
-	defer func() {
-		os.Remove(wip)
-	}()
+	if dist.Checksum == "" && dist.ChecksumUrl != "" {
+		if u, err := url.Parse(dist.ChecksumUrl); err != nil {
+			return err
+		} else {
+			sumUrl = u
+		}
+	}
 
 	httpClient := &http.Client{
 		Transport: &http.Transport{
@@ -113,31 +298,46 @@ func (r *Roster) install0(name string, output io.Writer, env []string) error {
 		// Timeout: time.Duration(10) * time.Second, // download takes longer than 10 seconds
 	}
 
-	var sumBytes []byte
-	if sumUrl != nil {
-		sumRsp, err := httpClient.Do(&http.Request{
-			Method: "GET",
-			URL:    sumUrl,
-		})
-		if err != nil {
+	job.sourceUrl = srcUrl.String()
+	job.reportPhase(opts, PHASE_DOWNLOAD)
+	var expectSum string
+	if dist.Checksum != "" {
+		if sum, err := ParseDigest(dist.Checksum); err != nil {
 			return err
+		} else {
+			expectSum = sum
 		}
-		defer sumRsp.Body.Close()
-		if sumRsp.StatusCode != http.StatusOK {
-			content, _ := io.ReadAll(sumRsp.Body)
-			return fmt.Errorf("failed to download %q: %s %s", sumUrl, sumRsp.Status, string(content))
+	} else if sumUrl != nil {
+		if sum, err := fetchChecksum(ctx, httpClient, sumUrl, dist.ArchiveBase); err == nil {
+			expectSum = sum
+		} else if known := r.storedChecksum(srcUrl.String()); known != "" && isTransportError(err) {
+			// e.g. offline, the archive was downloaded from the url before
+			fmt.Fprintf(output, "checksum of %s is not available, %s\n", filepath.Base(srcUrl.Path), err)
+			expectSum = known
+		} else {
+			return err
 		}
+	}
 
-		sumBytes, err = io.ReadAll(sumRsp.Body)
-		if err != nil {
-			return err
+	if expectSum != "" && r.archiveStore != nil {
+		if stored := r.archiveStore.Get(expectSum); stored != "" {
+			job.archiveFile, job.keepArchive = stored, true
+			if err := r.verifyInstall(job, expectSum, output, opts); err == nil {
+				r.archiveStore.AddSource(expectSum, srcUrl.String())
+				fmt.Fprintf(output, "using cached %s\n", filepath.Base(stored))
+				return nil
+			}
+			// broken, download it again
+			r.archiveStore.Remove(expectSum)
+			job.archiveFile, job.keepArchive = archiveFile, false
 		}
 	}
 
-	rsp, err := httpClient.Do(&http.Request{
-		Method: "GET",
-		URL:    srcUrl,
-	})
+	req, err := http.NewRequestWithContext(ctx, "GET", srcUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -152,69 +352,266 @@ func (r *Roster) install0(name string, output io.Writer, env []string) error {
 		return err
 	}
 
-	_, err = io.Copy(download, rsp.Body)
+	var total int64
+	if avails, err := r.LoadPackageDistributionAvailability(name, cache.Version()); err == nil {
+		for _, a := range avails {
+			if a.PlatformOS == dist.PlatformOS && a.PlatformArch == dist.PlatformArch {
+				total = a.ContentLength
+				break
+			}
+		}
+	}
+	if total <= 0 && rsp.ContentLength > 0 {
+		total = rsp.ContentLength
+	}
+	_, err = io.Copy(download, newProgressReader(rsp.Body, name, total, opts))
+	download.Close()
 	if err != nil {
 		return err
 	}
-	download.Close()
 	fmt.Fprintf(output, "downloaded %s\n", filepath.Base(download.Name()))
 
-	// check sum
-	if len(sumBytes) > 0 {
-		hmx := sha256.New()
-		file, err := os.OpenFile(archiveFile, os.O_RDONLY, 0)
-		if err != nil {
+	if err := r.verifyInstall(job, expectSum, output, opts); err != nil {
+		return err
+	}
+	if expectSum != "" && r.archiveStore != nil {
+		if _, err := r.archiveStore.Put(expectSum, archiveFile); err != nil {
+			r.log.Warnf("archive store: %v", err)
+		} else if err := r.archiveStore.AddSource(expectSum, srcUrl.String()); err != nil {
+			r.log.Warnf("archive store: %v", err)
+		}
+	}
+	return nil
+}
+
+// fetchChecksum downloads the checksum file and returns the sha256 hex of the archive in it.
+func fetchChecksum(ctx context.Context, httpClient *http.Client, sumUrl *url.URL, archiveBase string) (string, error) {
+	sumReq, err := http.NewRequestWithContext(ctx, "GET", sumUrl.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	sumRsp, err := httpClient.Do(sumReq)
+	if err != nil {
+		return "", err
+	}
+	defer sumRsp.Body.Close()
+	if sumRsp.StatusCode != http.StatusOK {
+		content, _ := io.ReadAll(sumRsp.Body)
+		return "", fmt.Errorf("failed to download %q: %s %s", sumUrl, sumRsp.Status, string(content))
+	}
+	sumBytes, err := io.ReadAll(sumRsp.Body)
+	if err != nil {
+		return "", err
+	}
+	sum, err := ParseChecksum(sumBytes, archiveBase)
+	if err != nil {
+		return "", fmt.Errorf("invalid checksum file %q: %w", sumUrl, err)
+	}
+	return sum, nil
+}
+
+// isTransportError reports whether the err is that the server could not be reached,
+// not an http status or an invalid checksum file which may mean the archive was withdrawn or replaced.
+func isTransportError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// storedChecksum returns the checksum of the archive in the archive store which was downloaded from the url,
+// it returns empty string if the store does not have it.
+func (r *Roster) storedChecksum(srcUrl string) string {
+	if r.archiveStore == nil {
+		return ""
+	}
+	sum := r.archiveStore.Lookup(srcUrl)
+	if sum == "" || r.archiveStore.Get(sum) == "" {
+		return ""
+	}
+	return sum
+}
+
+// localArchiveInstall uses the local archive file for the job instead of downloading it.
+func (r *Roster) localArchiveInstall(job *installJob, archivePath string, output io.Writer, opts *opOptions) error {
+	archivePath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return err
+	}
+	if stat, err := os.Stat(archivePath); err != nil {
+		return err
+	} else if stat.IsDir() {
+		return fmt.Errorf("%q is a directory", archivePath)
+	}
+	archiveBase := filepath.Base(archivePath)
+	job.archiveFile = archivePath
+	job.keepArchive = true
+	job.sourceUrl = (&url.URL{Scheme: "file", Path: filepath.ToSlash(archivePath)}).String()
+	// the archive format of the distribution if the file has no known extension
+	if ext := ArchiveExt(archiveBase); ext != "" {
+		job.archiveExt = ext
+	}
+	// the archive can be an older version than the roster knows
+	if job.cache.Url == "" && job.cache.Github != nil {
+		if ver := archiveVersion(job.cache.Github.Repo, archiveBase, job.dist); ver != "" {
+			job.unarchiveDir = filepath.Join(filepath.Dir(job.unarchiveDir), ver)
+		}
+	}
+
+	var expectSum string
+	if opts.checksum != "" {
+		if sum, err := ParseDigest(opts.checksum); err != nil {
 			return err
+		} else {
+			expectSum = sum
 		}
-		if _, err := io.Copy(hmx, file); err != nil {
+	} else if sum, err := localChecksum(archivePath); err != nil {
+		return err
+	} else if sum != "" {
+		expectSum = sum
+	} else if job.dist.Checksum != "" {
+		if sum, err := ParseDigest(job.dist.Checksum); err != nil {
 			return err
+		} else {
+			expectSum = sum
 		}
-		file.Close()
-		checksum := base64.StdEncoding.EncodeToString(hmx.Sum(nil))
-		if checksum != string(sumBytes) {
-			return fmt.Errorf("checksum mismatch, try again. %s", checksum)
+	}
+	if expectSum == "" {
+		return fmt.Errorf("no checksum for %q", archivePath)
+	}
+	fmt.Fprintf(output, "using %s\n", archivePath)
+	return r.verifyInstall(job, expectSum, output, opts)
+}
+
+// localChecksum finds the checksum file next to the archive,
+// it returns empty string if there is no checksum file.
+func localChecksum(archivePath string) (string, error) {
+	archiveBase := filepath.Base(archivePath)
+	for _, sumFile := range []string{
+		archivePath + ".sum",
+		archivePath + ".sha256",
+		filepath.Join(filepath.Dir(archivePath), "SHA256SUMS"),
+	} {
+		content, err := os.ReadFile(sumFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", err
 		}
-		fmt.Fprintf(output, "checksum %s\n", checksum)
+		sum, err := ParseChecksum(content, archiveBase)
+		if err != nil {
+			return "", fmt.Errorf("invalid checksum file %q: %w", sumFile, err)
+		}
+		return sum, nil
 	}
+	return "", nil
+}
 
-	switch strings.ToLower(dist.ArchiveExt) {
-	case ".zip":
-		var cmd *exec.Cmd
-		if runtime.GOOS == "windows" {
-			cmd = exec.Command("powershell", "-Command", "Expand-Archive", "-Path", archiveFile, "-DestinationPath", unarchiveDir)
+// archiveVersion returns the version from the archive name
+// '<repo>-<version>-<os>-<arch>.tar.gz' or '<repo>-<version>.tar.gz'.
+func archiveVersion(repo string, archiveBase string, dist *PackageDistribution) string {
+	ext := ArchiveExt(archiveBase)
+	if ext == "" || !strings.HasPrefix(archiveBase, repo+"-") {
+		return ""
+	}
+	ver := strings.TrimSuffix(strings.TrimPrefix(archiveBase, repo+"-"), ext)
+	if dist.PlatformOS != "" && dist.PlatformArch != "" {
+		ver = strings.TrimSuffix(ver, fmt.Sprintf("-%s-%s", dist.PlatformOS, dist.PlatformArch))
+	}
+	return ver
+}
+
+// verifyInstall verifies the archive file of the job with the expected checksum.
+func (r *Roster) verifyInstall(job *installJob, expectSum string, output io.Writer, opts *opOptions) error {
+	if expectSum == "" {
+		return nil
+	}
+	job.reportPhase(opts, PHASE_VERIFY)
+	checksum, err := FileChecksum(job.archiveFile)
+	if err != nil {
+		return err
+	}
+	if checksum != expectSum {
+		return fmt.Errorf("checksum mismatch, try again. %s", checksum)
+	}
+	job.checksum = checksum
+	fmt.Fprintf(output, "checksum sha256:%s\n", checksum)
+	return nil
+}
+
+// applyInstall extracts the downloaded archive, switches the 'current' link
+// to the new version and runs the install script.
+func (r *Roster) applyInstall(ctx context.Context, job *installJob, output io.Writer, env []string, opts *opOptions) error {
+	name, meta, dist := job.name, job.meta, job.dist
+	archiveFile, unarchiveDir, currentVerDir := job.archiveFile, job.unarchiveDir, job.currentVerDir
+
+	if err := os.MkdirAll(unarchiveDir, 0755); err != nil {
+		return err
+	}
+	job.reportPhase(opts, PHASE_EXTRACT)
+	ext := job.archiveExt
+	if ext == "" {
+		if detected, err := DetectArchiveExt(archiveFile); err != nil {
+			return err
 		} else {
-			cmd = exec.Command("unzip", "-o", "-d", unarchiveDir, archiveFile)
+			ext = detected
 		}
-		cmd.Stdout = output
-		cmd.Stderr = output
-		err = cmd.Run()
-		if err != nil {
+	}
+	extractOpts := r.extractLimits
+	extractOpts.StripComponents = dist.StripComponents
+	switch {
+	case strings.EqualFold(ext, ".zip"):
+		if err := unzip.UnzipFileWithOptions(archiveFile, unarchiveDir, extractOpts); err != nil {
 			return err
 		}
-	case ".tar.gz":
+	case IsTarArchive(ext):
 		fd, err := os.Open(archiveFile)
 		if err != nil {
 			return err
 		}
-		if err := untar.Untar(fd, unarchiveDir, dist.StripComponents); err != nil {
+		if err := untar.UntarWithOptions(fd, unarchiveDir, extractOpts); err != nil {
 			fd.Close()
 			return err
 		}
 		fd.Close()
+	default:
+		// single binary distribution
+		if err := copyExecutable(archiveFile, filepath.Join(unarchiveDir, dist.ArchiveBase)); err != nil {
+			return err
+		}
 	}
 	inst, err := r.InstalledVersion(name)
+	// the data and config dirs of the old version, or of the uninstalled one which kept them
+	keepFrom := ""
+	if err == nil && inst != nil && inst.Path != "" && inst.Path != unarchiveDir {
+		keepFrom = inst.Path
+	} else if err != nil {
+		keepFrom = uninstalledVersionDir(filepath.Dir(unarchiveDir), unarchiveDir)
+	}
+	if keepFrom != "" {
+		if err := moveKeptDirs(meta, keepFrom, unarchiveDir, output); err != nil {
+			return fmt.Errorf("keeping data and config dirs: %w", err)
+		}
+	}
 	if _, err := os.Stat(currentVerDir); err == nil {
 		// remove symlink
 		if err := os.Remove(currentVerDir); err != nil {
 			return err
 		}
 	}
-	if err == nil && inst != nil && inst.Path != "" {
+	if err == nil && inst != nil && inst.Path != "" && inst.Path != unarchiveDir {
 		// remove old version
 		os.RemoveAll(inst.Path)
+	} else if keepFrom != "" {
+		// the uninstalled version is removed if it had only the kept dirs
+		removeEmptyDirs(keepFrom)
 	}
 
 	// new symlink
+	job.reportPhase(opts, PHASE_LINK)
 	// !! windows requires abs path
 	oldName, _ := filepath.Abs(filepath.FromSlash(unarchiveDir))
 	newName, _ := filepath.Abs(filepath.FromSlash(currentVerDir))
@@ -223,47 +620,139 @@ func (r *Roster) install0(name string, output io.Writer, env []string) error {
 		return fmt.Errorf("symlink %q -> %q: %w", oldName, newName, err)
 	}
 
-	installRun := FindScript(meta.InstallRecipe.Scripts, runtime.GOOS)
-	if runtime.GOOS == "windows" {
-		if sc, err := MakeScriptFile([]string{installRun}, unarchiveDir, "__install__.cmd"); err != nil {
-			r.log.Errorf("make script file: %v", err)
+	if meta.InstallRecipe != nil {
+		job.reportPhase(opts, PHASE_SCRIPT)
+		installRun := FindPlatformScript(meta.InstallRecipe.Scripts, runtime.GOOS)
+		if err := r.runScript(ctx, name, installRun, unarchiveDir, "install", output, env); err != nil {
+			r.log.Warnf("running install script: %v", err)
 			return err
-		} else {
-			cmd := exec.Command("cmd", "/c", sc)
-			cmd.Dir = unarchiveDir
-			cmd.Stdout = output
-			cmd.Stderr = output
-			cmd.Env = append(os.Environ(), env...)
-			err = cmd.Run()
-			if err != nil {
-				r.log.Warnf("running install script %q: %v", sc, err)
-				return err
-			}
-		}
-		os.Remove(filepath.Join(unarchiveDir, "__install__.cmd"))
-	} else {
-		if meta.InstallRecipe != nil {
-			if sc, err := MakeScriptFile([]string{installRun}, unarchiveDir, "__install__.sh"); err != nil {
-				return err
-			} else {
-				cmd := exec.Command("sh", "-c", sc)
-				cmd.Dir = unarchiveDir
-				cmd.Stdout = output
-				cmd.Stderr = output
-				cmd.Env = append(os.Environ(), env...)
-				err = cmd.Run()
-				if err != nil {
-					return err
-				}
-			}
-			os.Remove(filepath.Join(unarchiveDir, "__install__.sh"))
 		}
 	}
 
+	if err := r.writeManifest(job); err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+
 	// remove archive file
-	err = os.Remove(archiveFile)
+	if !job.keepArchive {
+		err = os.Remove(archiveFile)
+		if err != nil {
+			r.log.Errorf("cleaning download file %q: %v", archiveFile, err)
+		}
+	}
+	return nil
+}
+
+// moveKeptDirs moves the data and config dirs of the package from the old version dir into the new one,
+// they replace the ones which come with the new version.
+func moveKeptDirs(meta *PackageMeta, oldDir string, newDir string, output io.Writer) error {
+	olds, err := keptPaths(meta, oldDir)
 	if err != nil {
-		r.log.Errorf("cleaning download file %q: %v", archiveFile, err)
+		return err
+	}
+	// the parent dirs first, the sub dirs are moved with them
+	slices.SortFunc(olds, func(a, b string) int { return len(a) - len(b) })
+	for _, old := range olds {
+		if _, err := os.Lstat(old); err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(oldDir, old)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(newDir, rel)
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(old, dst); err != nil {
+			return err
+		}
+		fmt.Fprintf(output, "kept %s of %s\n", filepath.ToSlash(rel), filepath.Base(oldDir))
 	}
 	return nil
 }
+
+// uninstalledVersionDir returns the version dir in the pkgDir which Uninstall left with the kept dirs,
+// the most recently modified one if there are many. It returns empty string if there is none.
+func uninstalledVersionDir(pkgDir string, except string) string {
+	dirs, err := versionDirs(pkgDir)
+	if err != nil {
+		return ""
+	}
+	ret, latest := "", time.Time{}
+	for _, dir := range dirs {
+		if dir == except {
+			continue
+		}
+		// the installed or retained versions have the manifest
+		if _, err := os.Stat(filepath.Join(dir, MANIFEST_FILE)); err == nil {
+			continue
+		}
+		if stat, err := os.Stat(dir); err == nil && stat.ModTime().After(latest) {
+			ret, latest = dir, stat.ModTime()
+		}
+	}
+	return ret
+}
+
+// removeEmptyDirs removes the empty dirs under the dir and the dir itself if it gets empty.
+func removeEmptyDirs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			removeEmptyDirs(filepath.Join(dir, entry.Name()))
+		}
+	}
+	os.Remove(dir)
+}
+
+// writeManifest records the files of the new version directory into the manifest file,
+// it is called after the install script so that the files made by the script are included.
+func (r *Roster) writeManifest(job *installJob) error {
+	if job.checksum == "" {
+		if sum, err := FileChecksum(job.archiveFile); err != nil {
+			return err
+		} else {
+			job.checksum = sum
+		}
+	}
+	files, err := ScanManifestFiles(job.unarchiveDir)
+	if err != nil {
+		return err
+	}
+	manifest := &InstallManifest{
+		Name:            job.name,
+		Version:         filepath.Base(job.unarchiveDir),
+		SourceUrl:       job.sourceUrl,
+		ArchiveChecksum: job.checksum,
+		RosterCommit:    r.rosterCommit(job.cache.rosterName),
+		Depends:         job.meta.Depends,
+		InstalledAt:     time.Now(),
+		Files:           files,
+	}
+	return WriteManifestFile(filepath.Join(job.unarchiveDir, MANIFEST_FILE), manifest)
+}
+
+// copyExecutable copies the src file to dst with the executable permission.
+func copyExecutable(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -1,10 +1,21 @@
 package pkgs
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/machbase/neo-pkgdev/pkgs/untar"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStripComponents(t *testing.T) {
@@ -68,3 +79,357 @@ func TestStripComponents(t *testing.T) {
 		}
 	}
 }
+
+func TestInstallMany(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tgz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+		"beta-1.0.0.tgz":  makeTarGz(t, map[string]string{"index.html": "beta"}),
+		"gamma-1.0.0.tgz": makeTarGz(t, map[string]string{"index.html": "gamma"}),
+	})
+
+	output := &bytes.Buffer{}
+	result, exitCode := roster.InstallMany([]string{"alpha", "beta", "gamma", "alpha"}, 2, output, nil)
+	require.Equal(t, 0, exitCode, output.String())
+	require.Len(t, result, 3)
+	for i, name := range []string{"alpha", "beta", "gamma"} {
+		require.Equal(t, name, result[i].PkgName)
+		require.NoError(t, result[i].Err)
+		require.NotNil(t, result[i].Installed)
+		require.Contains(t, output.String(), name+": installing "+name+"\n")
+	}
+
+	result, exitCode = roster.InstallMany([]string{"alpha", "not-exists"}, 2, io.Discard, nil)
+	require.Equal(t, 1, exitCode)
+	require.NoError(t, result[0].Err)
+	require.Error(t, result[1].Err)
+
+	_, exitCode = roster.InstallMany([]string{"not-exists"}, 2, io.Discard, nil)
+	require.Equal(t, 2, exitCode)
+}
+
+func TestInstallChecksum(t *testing.T) {
+	archive := makeTarGz(t, map[string]string{"index.html": "alpha"})
+	sum := sha256.Sum256(archive)
+	roster, svr := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tgz": archive,
+		"SHA256SUMS":      []byte(hex.EncodeToString(sum[:]) + "  alpha-1.0.0.tgz\n"),
+	})
+	cache, err := roster.LoadPackageCache("alpha")
+	require.NoError(t, err)
+
+	// checksum file
+	cache.ChecksumUrl = svr.URL + "/SHA256SUMS"
+	require.NoError(t, roster.WritePackageCache(cache))
+	output := &bytes.Buffer{}
+	st := roster.Install("alpha", output, nil)
+	require.NoError(t, st.Err)
+	require.Contains(t, output.String(), "checksum sha256:"+hex.EncodeToString(sum[:]))
+
+	// inline checksum takes precedence over the checksum file
+	cache.Checksums = map[string]string{"*": strings.Repeat("0", 64)}
+	require.NoError(t, roster.WritePackageCache(cache))
+	st = roster.Install("alpha", io.Discard, nil)
+	require.ErrorContains(t, st.Err, "checksum mismatch")
+
+	cache.Checksums = map[string]string{"*": "sha256:" + hex.EncodeToString(sum[:])}
+	require.NoError(t, roster.WritePackageCache(cache))
+	st = roster.Install("alpha", io.Discard, nil)
+	require.NoError(t, st.Err)
+}
+
+func TestInstallArchiveFormats(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz":      makeTarGz(t, map[string]string{"index.html": "alpha"}),
+		"beta-1.0.0-download":     makeTarGz(t, map[string]string{"index.html": "beta"}),
+		"gamma-1.0.0-linux-amd64": []byte("#!/bin/sh\necho gamma\n"),
+	})
+	for _, name := range []string{"alpha", "beta"} {
+		st := roster.Install(name, io.Discard, nil)
+		require.NoError(t, st.Err, name)
+		content, err := os.ReadFile(filepath.Join(st.Installed.Path, "index.html"))
+		require.NoError(t, err, name)
+		require.Equal(t, name, string(content))
+	}
+	st := roster.Install("gamma", io.Discard, nil)
+	require.NoError(t, st.Err)
+	require.Equal(t, "1.0.0", st.Installed.Version)
+	stat, err := os.Stat(filepath.Join(st.Installed.Path, "gamma-1.0.0-linux-amd64"))
+	require.NoError(t, err)
+	require.NotZero(t, stat.Mode().Perm()&0100)
+}
+
+func TestInstallExtractLimits(t *testing.T) {
+	files := map[string]string{"index.html": "0123456789", "app.js": "0123456789"}
+	base, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, files),
+		"bravo-1.0.0.zip":    makeZip(t, files),
+	})
+	roster, err := NewRoster(base.baseDir, WithArchiveStore(nil), WithExtractLimits(untar.Options{MaxTotalSize: 15}))
+	require.NoError(t, err)
+	for _, name := range []string{"alpha", "bravo"} {
+		st := roster.Install(name, io.Discard, nil)
+		var limitErr *untar.LimitError
+		require.ErrorAs(t, st.Err, &limitErr, name)
+		require.Equal(t, "MaxTotalSize", limitErr.Limit, name)
+	}
+	for _, name := range []string{"alpha", "bravo"} {
+		installTestPackage(t, base, name)
+	}
+}
+
+func TestInstallArchive(t *testing.T) {
+	archive := makeTarGz(t, map[string]string{"index.html": "alpha"})
+	roster, _ := newTestRoster(t, map[string][]byte{"alpha-1.0.0.tar.gz": archive})
+	sum := sha256.Sum256(archive)
+	dir := t.TempDir()
+	archiveFile := filepath.Join(dir, "alpha-1.0.0.tar.gz")
+	require.NoError(t, os.WriteFile(archiveFile, archive, 0644))
+
+	// no checksum
+	st := roster.InstallArchive("alpha", archiveFile, io.Discard, nil)
+	require.ErrorContains(t, st.Err, "no checksum")
+
+	// checksum flag
+	st = roster.InstallArchive("alpha", archiveFile, io.Discard, nil, WithChecksum(strings.Repeat("0", 64)))
+	require.ErrorContains(t, st.Err, "checksum mismatch")
+	st = roster.InstallArchive("alpha", archiveFile, io.Discard, nil, WithChecksum(hex.EncodeToString(sum[:])))
+	require.NoError(t, st.Err)
+
+	// sidecar checksum file
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "SHA256SUMS"), []byte(hex.EncodeToString(sum[:])+"  alpha-1.0.0.tar.gz\n"), 0644))
+	output := &bytes.Buffer{}
+	st = roster.InstallArchive("alpha", archiveFile, output, nil)
+	require.NoError(t, st.Err)
+	require.Contains(t, output.String(), "checksum sha256:"+hex.EncodeToString(sum[:]))
+	content, err := os.ReadFile(filepath.Join(st.Installed.Path, "index.html"))
+	require.NoError(t, err)
+	require.Equal(t, "alpha", string(content))
+
+	// the local archive is kept
+	_, err = os.Stat(archiveFile)
+	require.NoError(t, err)
+
+	// the file without the known extension is the archive format of the distribution
+	noExtFile := filepath.Join(dir, "download")
+	require.NoError(t, os.WriteFile(noExtFile, archive, 0644))
+	st = roster.InstallArchive("alpha", noExtFile, io.Discard, nil, WithChecksum(hex.EncodeToString(sum[:])))
+	require.NoError(t, st.Err)
+	content, err = os.ReadFile(filepath.Join(st.Installed.Path, "index.html"))
+	require.NoError(t, err)
+	require.Equal(t, "alpha", string(content))
+}
+
+func TestInstallManifest(t *testing.T) {
+	archive := makeTarGz(t, map[string]string{"index.html": "alpha", "bin/run.sh": "#!/bin/sh\n"})
+	archiveSum := sha256.Sum256(archive)
+	roster, svr := newTestRoster(t, map[string][]byte{"alpha-1.0.0.tar.gz": archive})
+
+	st := roster.Install("alpha", io.Discard, nil)
+	require.NoError(t, st.Err)
+	require.Equal(t, filepath.Join(st.Installed.Path, MANIFEST_FILE), st.Installed.ManifestPath)
+
+	manifest, err := st.Installed.Manifest()
+	require.NoError(t, err)
+	require.Equal(t, "alpha", manifest.Name)
+	require.Equal(t, st.Installed.Version, manifest.Version)
+	require.Equal(t, svr.URL+"/alpha-1.0.0.tar.gz", manifest.SourceUrl)
+	require.Equal(t, hex.EncodeToString(archiveSum[:]), manifest.ArchiveChecksum)
+	require.False(t, manifest.InstalledAt.IsZero())
+
+	paths := []string{}
+	for _, f := range manifest.Files {
+		paths = append(paths, f.Path)
+	}
+	require.Equal(t, []string{"bin", "bin/run.sh", "index.html"}, paths)
+	indexSum := sha256.Sum256([]byte("alpha"))
+	require.Equal(t, hex.EncodeToString(indexSum[:]), manifest.Files[2].Sha256)
+	require.Equal(t, int64(5), manifest.Files[2].Size)
+	require.True(t, manifest.Files[0].Mode.IsDir())
+}
+
+func TestWorkMarker(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+	})
+	var marker *WorkMarker
+	st := roster.Install("alpha", io.Discard, nil, WithProgress(ProgressFunc(func(p *InstallProgress) {
+		if p.Phase == PHASE_LINK {
+			m, err := ReadWorkMarker(filepath.Join(roster.distDir, "alpha", "wip"))
+			require.NoError(t, err)
+			marker = m
+		}
+	})))
+	require.NoError(t, st.Err)
+	require.NotNil(t, marker)
+	require.Equal(t, os.Getpid(), marker.Pid)
+	require.Equal(t, PHASE_LINK, marker.Phase)
+	require.False(t, marker.Stale(DEFAULT_WORK_TIMEOUT))
+	require.False(t, st.Installed.WorkInProgress)
+
+	wip := filepath.Join(roster.distDir, "alpha", "wip")
+	hostname, _ := os.Hostname()
+
+	// alive
+	require.NoError(t, WriteWorkMarker(wip, &WorkMarker{Pid: os.Getpid(), Hostname: hostname, StartedAt: time.Now().Add(-time.Minute), Phase: PHASE_EXTRACT}))
+	inst, err := roster.InstalledVersion("alpha")
+	require.NoError(t, err)
+	require.True(t, inst.WorkInProgress)
+	require.False(t, inst.WorkStale)
+	require.Equal(t, "extract", inst.WorkPhase)
+	require.GreaterOrEqual(t, inst.WorkAge, int64(60))
+
+	// timeout
+	require.NoError(t, WriteWorkMarker(wip, &WorkMarker{Pid: os.Getpid(), Hostname: hostname, StartedAt: time.Now().Add(-2 * DEFAULT_WORK_TIMEOUT)}))
+	inst, err = roster.InstalledVersion("alpha")
+	require.NoError(t, err)
+	require.False(t, inst.WorkInProgress)
+	require.True(t, inst.WorkStale)
+
+	// process is gone
+	cmd := exec.Command("go", "version")
+	require.NoError(t, cmd.Run())
+	require.NoError(t, WriteWorkMarker(wip, &WorkMarker{Pid: cmd.Process.Pid, Hostname: hostname, StartedAt: time.Now()}))
+	inst, err = roster.InstalledVersion("alpha")
+	require.NoError(t, err)
+	require.False(t, inst.WorkInProgress)
+	require.True(t, inst.WorkStale)
+
+	// the old marker has only the url
+	require.NoError(t, os.WriteFile(wip, []byte("http://example.com/alpha.tar.gz"), 0644))
+	inst, err = roster.InstalledVersion("alpha")
+	require.NoError(t, err)
+	require.True(t, inst.WorkInProgress)
+}
+
+func TestInstallContext(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	st := roster.InstallContext(ctx, "alpha", io.Discard, nil)
+	require.ErrorIs(t, st.Err, context.Canceled)
+	_, err := roster.InstalledVersion("alpha")
+	require.Error(t, err)
+
+	result, exitCode := roster.InstallManyContext(ctx, []string{"alpha"}, 1, io.Discard, nil)
+	require.Equal(t, 2, exitCode)
+	require.ErrorIs(t, result[0].Err, context.Canceled)
+}
+
+func TestInstallEvents(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+	})
+	buf := &bytes.Buffer{}
+	st := roster.Install("alpha", io.Discard, nil, WithEvents(NewJSONEventWriter(buf)))
+	require.NoError(t, st.Err)
+
+	types := []EventType{}
+	phases := []InstallPhase{}
+	outputs := []string{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		evt := &Event{}
+		require.NoError(t, dec.Decode(evt))
+		require.Equal(t, "install", evt.Op)
+		require.Equal(t, "alpha", evt.PkgName)
+		require.False(t, evt.Time.IsZero())
+		if len(types) == 0 || types[len(types)-1] != evt.Type {
+			types = append(types, evt.Type)
+		}
+		switch evt.Type {
+		case EVENT_PROGRESS:
+			if len(phases) == 0 || phases[len(phases)-1] != evt.Progress.Phase {
+				phases = append(phases, evt.Progress.Phase)
+			}
+		case EVENT_SCRIPT_OUTPUT:
+			outputs = append(outputs, evt.Output)
+		}
+	}
+	require.Equal(t, EVENT_STARTED, types[0])
+	require.Equal(t, EVENT_FINISHED, types[len(types)-1])
+	require.Equal(t, []InstallPhase{PHASE_RESOLVE, PHASE_DOWNLOAD, PHASE_EXTRACT, PHASE_LINK, PHASE_SCRIPT}, phases)
+	require.Contains(t, outputs, "installing alpha")
+
+	buf.Reset()
+	st = roster.Install("not-exists", io.Discard, nil, WithEvents(NewJSONEventWriter(buf)))
+	require.Error(t, st.Err)
+	require.Contains(t, buf.String(), `"type":"error"`)
+}
+
+func TestScriptLogs(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+	})
+	roster.maxScriptLogs = 2
+	for i := 0; i < 3; i++ {
+		require.NoError(t, roster.Install("alpha", io.Discard, nil).Err)
+		time.Sleep(5 * time.Millisecond)
+	}
+	logs, err := roster.ScriptLogs("alpha")
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	content, err := os.ReadFile(logs[1])
+	require.NoError(t, err)
+	require.Contains(t, string(content), "installing alpha\n")
+	require.Contains(t, string(content), "# done in ")
+
+	// the logs are kept after uninstall
+	require.NoError(t, roster.Uninstall("alpha", io.Discard, nil))
+	logs, err = roster.ScriptLogs("alpha")
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	_, err = roster.InstalledVersion("alpha")
+	require.Error(t, err)
+}
+
+func TestInstallOtherRoster(t *testing.T) {
+	base, svr := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+		"delta.tar.gz":       makeTarGz(t, map[string]string{"index.html": "delta"}),
+	})
+	writeTestPackage(t, base.baseDir, "labs", "delta", svr.URL+"/delta.tar.gz")
+	roster, err := NewRoster(base.baseDir, WithArchiveStore(nil), WithRosterRepo("labs", "https://example.com/labs.git"))
+	require.NoError(t, err)
+
+	metas := []string{}
+	roster.WalkPackageMeta(func(name string) bool { metas = append(metas, name); return true })
+	require.Equal(t, []string{"alpha", "labs/delta"}, metas)
+
+	require.NoError(t, roster.Install("alpha", io.Discard, nil).Err)
+	st := roster.Install("labs/delta", io.Discard, nil)
+	require.NoError(t, st.Err)
+	require.Equal(t, filepath.Join(roster.distDir, "labs", "delta", "delta"), st.Installed.Path)
+
+	installed, err := roster.InstalledPackages()
+	require.NoError(t, err)
+	require.Equal(t, []string{"alpha", "labs/delta"}, installed.Installed)
+
+	result, err := roster.Search("labs/delta", 0)
+	require.NoError(t, err)
+	require.NotNil(t, result.ExactMatch)
+	require.Equal(t, "labs/delta", result.ExactMatch.FullName())
+	require.Equal(t, "delta", result.ExactMatch.InstalledVersion)
+
+	logs, err := roster.ScriptLogs("labs/delta")
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+
+	// the old versions installed the package into 'dist/<pkgName>'
+	require.NoError(t, roster.movePkgDir(filepath.Join(roster.distDir, "labs", "delta"), filepath.Join(roster.distDir, "delta")))
+	roster, err = NewRoster(base.baseDir, WithArchiveStore(nil), WithRosterRepo("labs", "https://example.com/labs.git"))
+	require.NoError(t, err)
+	inst, err := roster.InstalledVersion("labs/delta")
+	require.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(inst.CurrentPath, "index.html"))
+	require.NoError(t, err)
+	require.Equal(t, "delta", string(content))
+	_, err = os.Stat(filepath.Join(roster.distDir, "delta"))
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, roster.Uninstall("labs/delta", io.Discard, nil))
+	installed, err = roster.InstalledPackages()
+	require.NoError(t, err)
+	require.Equal(t, []string{"alpha"}, installed.Installed)
+}
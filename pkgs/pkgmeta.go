@@ -1,6 +1,7 @@
 package pkgs
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,8 +17,13 @@ import (
 )
 
 type PackageMeta struct {
-	Distributable      Distributable    `yaml:"distributable" json:"distributable"`
-	Description        string           `yaml:"description" json:"description"`
+	Distributable Distributable `yaml:"distributable" json:"distributable"`
+	Description   string        `yaml:"description" json:"description"`
+	// Keywords are the words to find the package by Search(), in addition to the name and the description.
+	Keywords []string `yaml:"keywords,omitempty" json:"keywords,omitempty"`
+	// Revision is the revision of the package recipe for the same upstream version,
+	// increase it to ship the rebuilt artifacts, e.g. '1.2.3-r2'.
+	Revision           int              `yaml:"revision,omitempty" json:"revision,omitempty"`
 	Platforms          []string         `yaml:"platforms" json:"platforms"`
 	BuildRecipe        BuildRecipe      `yaml:"build" json:"build"`
 	Provides           []string         `yaml:"provides" json:"provides"`
@@ -25,6 +31,14 @@ type PackageMeta struct {
 	InstallRecipe      *InstallRecipe   `yaml:"install,omitempty" json:"install,omitempty"`
 	UninstallRecipe    *UninstallRecipe `yaml:"uninstall,omitempty" json:"uninstall,omitempty"`
 	UninstallRecipeWin *UninstallRecipe `yaml:"uninstall_windows,omitempty" json:"uninstall_windows,omitempty"`
+	// DataDirs and ConfigDirs are the dirs relative to the version dir which are kept
+	// when the package is uninstalled without purge, and moved into the new version dir by the upgrades.
+	// Verify does not check the files of the DataDirs.
+	DataDirs   []string `yaml:"data_dirs,omitempty" json:"data_dirs,omitempty"`
+	ConfigDirs []string `yaml:"config_dirs,omitempty" json:"config_dirs,omitempty"`
+	// Depends are the packages which this package requires, e.g. the shared backend of an app.
+	// The packages of the other rosters are '<rosterName>/<pkgName>'.
+	Depends []string `yaml:"depends,omitempty" json:"depends,omitempty"`
 
 	rosterName RosterName `json:"-"`
 	pkgName    string     `json:"-"`
@@ -42,6 +56,12 @@ type Distributable struct {
 	Github          string `yaml:"github"`
 	Url             string `yaml:"url"`
 	StripComponents int    `yaml:"strip_components"`
+	// ChecksumUrl is the url template of the checksum file of Url,
+	// the file can be in SHA256SUMS or sha256sum format, or contains only the digest.
+	ChecksumUrl string `yaml:"checksum_url,omitempty"`
+	// Checksums are the sha256 digests of Url per platform (e.g. 'linux/amd64'),
+	// '*' is for the platform independent distribution.
+	Checksums map[string]string `yaml:"checksums,omitempty"`
 }
 
 type BuildRecipe struct {
@@ -50,22 +70,28 @@ type BuildRecipe struct {
 }
 
 type Script struct {
-	Run      string `yaml:"run"`
-	Platform string `yaml:"on,omitempty"`
+	Run      string        `yaml:"run"`
+	Platform string        `yaml:"on,omitempty"`
+	Timeout  time.Duration `yaml:"timeout,omitempty"` // e.g. '30s', '5m', no timeout if 0
 }
 
 func FindScript(scripts []Script, platform string) string {
-	ret := ""
+	return FindPlatformScript(scripts, platform).Run
+}
+
+// FindPlatformScript returns the script for the platform, or the script without platform.
+func FindPlatformScript(scripts []Script, platform string) Script {
+	ret := Script{}
 	if len(scripts) == 1 {
-		ret = scripts[0].Run
+		ret = scripts[0]
 	} else {
 		for _, script := range scripts {
 			if script.Platform == "" {
-				ret = script.Run
+				ret = script
 				continue
 			}
 			if script.Platform == platform {
-				return script.Run
+				return script
 			}
 		}
 	}
@@ -97,7 +123,7 @@ func LoadPackageMetaFile(path string) (*PackageMeta, error) {
 		return nil, err
 	}
 	ret.pkgName = filepath.Base(filepath.Dir(path))
-	ret.rosterName = RosterName(filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(path)))))
+	ret.rosterName = RosterName(filepath.Base(RosterDirOf(path)))
 	return ret, nil
 }
 
@@ -115,21 +141,18 @@ type InstalledPackages struct {
 	Installed []string
 }
 
+// InstalledPackages returns the names of the installed packages,
+// the packages of the other rosters are named '<rosterName>/<pkgName>'.
 func (r *Roster) InstalledPackages() (*InstalledPackages, error) {
-	path := filepath.Join(r.distDir)
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return nil, err
-	}
 	ret := &InstalledPackages{}
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		if _, err := os.Stat(filepath.Join(path, entry.Name(), "current")); err != nil {
-			continue
+	err := r.walkPkgDirs(func(pkgName string, pkgDir string) {
+		if _, err := os.Stat(filepath.Join(pkgDir, "current")); err != nil {
+			return
 		}
-		ret.Installed = append(ret.Installed, entry.Name())
+		ret.Installed = append(ret.Installed, pkgName)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return ret, nil
 }
@@ -154,10 +177,14 @@ func (r *Roster) FeaturedPackages() (*FeaturedPackages, error) {
 // WalkPackages walks all caches.
 // if callback returns false, it will stop walking.
 func (roster *Roster) WalkPackageCache(cb func(pkgName string) bool) error {
-	for _, rosterName := range []RosterName{ROSTER_CENTRAL} {
+	for _, rosterName := range roster.rosters() {
 		cacheDir := filepath.Join(roster.metaDir, string(rosterName), ".cache")
 		entries, err := os.ReadDir(cacheDir)
 		if err != nil {
+			if rosterName != ROSTER_CENTRAL && os.IsNotExist(err) {
+				// not synced yet
+				continue
+			}
 			return err
 		}
 		for _, entry := range entries {
@@ -178,9 +205,13 @@ func (roster *Roster) WalkPackageCache(cb func(pkgName string) bool) error {
 // WalkPackageMeta walks all packages.
 // if callback returns false, it will stop walking.
 func (r *Roster) WalkPackageMeta(cb func(name string) bool) error {
-	for _, rosterName := range []RosterName{ROSTER_CENTRAL} {
+	for _, rosterName := range r.rosters() {
 		entries, err := os.ReadDir(filepath.Join(r.metaDir, string(rosterName), "projects"))
 		if err != nil {
+			if rosterName != ROSTER_CENTRAL && os.IsNotExist(err) {
+				// not synced yet
+				continue
+			}
 			return err
 		}
 		for _, entry := range entries {
@@ -207,8 +238,13 @@ type SyncCheckStatus struct {
 }
 
 func (r *Roster) SyncCheck() ([]*SyncCheckStatus, error) {
+	return r.SyncCheckContext(context.Background())
+}
+
+func (r *Roster) SyncCheckContext(ctx context.Context) ([]*SyncCheckStatus, error) {
 	ret := []*SyncCheckStatus{}
-	for rosterName, rosterRepoUrl := range ROSTER_REPOS {
+	for _, rosterName := range r.rosters() {
+		rosterRepoUrl := r.rosterRepos[rosterName]
 		repoPath := filepath.Join(r.metaDir, string(rosterName))
 		if _, err := os.Stat(repoPath); err != nil {
 			ret = append(ret, &SyncCheckStatus{
@@ -236,7 +272,7 @@ func (r *Roster) SyncCheck() ([]*SyncCheckStatus, error) {
 			Name: string(git.DefaultRemoteName),
 			URLs: []string{rosterRepoUrl},
 		})
-		remoteRefs, err := remote.List(&git.ListOptions{})
+		remoteRefs, err := remote.ListContext(ctx, &git.ListOptions{})
 		if err != nil {
 			r.log.Warnf("%s List error:%s", rosterName, err)
 			ret = append(ret, &SyncCheckStatus{
@@ -271,8 +307,8 @@ func (r *Roster) SyncCheck() ([]*SyncCheckStatus, error) {
 }
 
 func (r *Roster) SyncAll() error {
-	for rosterName, rosterRepoUrl := range ROSTER_REPOS {
-		if err := r.Sync(rosterName, rosterRepoUrl); err != nil {
+	for _, rosterName := range r.rosters() {
+		if err := r.Sync(rosterName, r.rosterRepos[rosterName]); err != nil {
 			return err
 		}
 	}
@@ -280,11 +316,16 @@ func (r *Roster) SyncAll() error {
 }
 
 func (r *Roster) Sync(rosterName RosterName, rosterRepoUrl string) error {
+	return r.SyncContext(context.Background(), rosterName, rosterRepoUrl)
+}
+
+// SyncContext is Sync with the ctx which cancels the git clone and pull.
+func (r *Roster) SyncContext(ctx context.Context, rosterName RosterName, rosterRepoUrl string) error {
 	var repo *git.Repository
 	var isBare = false
 	repoPath := filepath.Join(r.metaDir, string(rosterName))
 	if _, err := os.Stat(repoPath); err != nil {
-		repo, err = git.PlainClone(repoPath, isBare, &git.CloneOptions{
+		repo, err = git.PlainCloneContext(ctx, repoPath, isBare, &git.CloneOptions{
 			URL:           rosterRepoUrl,
 			RemoteName:    string(git.DefaultRemoteName),
 			ReferenceName: plumbing.ReferenceName("refs/heads/main"),
@@ -310,7 +351,7 @@ func (r *Roster) Sync(rosterName RosterName, rosterRepoUrl string) error {
 		return fmt.Errorf("reset error: %w", err)
 	}
 
-	err = w.Pull(&git.PullOptions{
+	err = w.PullContext(ctx, &git.PullOptions{
 		RemoteURL:     rosterRepoUrl,
 		RemoteName:    string(git.DefaultRemoteName),
 		ReferenceName: plumbing.ReferenceName("refs/heads/main"),
@@ -325,8 +366,8 @@ func (r *Roster) Sync(rosterName RosterName, rosterRepoUrl string) error {
 }
 
 func (r *Roster) PushAllCache() error {
-	for rosterName, rosterRepoUrl := range ROSTER_REPOS {
-		if err := r.PushCache(rosterName, rosterRepoUrl); err != nil {
+	for _, rosterName := range r.rosters() {
+		if err := r.PushCache(rosterName, r.rosterRepos[rosterName]); err != nil {
 			return err
 		}
 	}
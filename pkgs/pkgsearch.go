@@ -4,6 +4,7 @@ import (
 	"runtime"
 	"slices"
 	"strings"
+	"unicode"
 )
 
 type PackageSearch struct {
@@ -93,7 +94,7 @@ func (r *Roster) Search(name string, possible int) (*PackageSearchResult, error)
 }
 
 func (r *Roster) CheckAvailabilityPackage(cache *PackageCache) error {
-	avails, err := r.LoadPackageDistributionAvailability(cache.Name, cache.LatestVersion)
+	avails, err := r.LoadPackageDistributionAvailability(cache.FullName(), cache.Version())
 	if err != nil {
 		return err
 	}
@@ -110,7 +111,7 @@ func (r *Roster) CheckAvailabilityPackage(cache *PackageCache) error {
 }
 
 func (r *Roster) CheckInstalledPackage(cache *PackageCache) error {
-	inst, err := r.InstalledVersion(cache.Name)
+	inst, err := r.InstalledVersion(cache.FullName())
 	if err != nil {
 		return err
 	}
@@ -125,8 +126,9 @@ func (r *Roster) CheckInstalledPackage(cache *PackageCache) error {
 }
 
 // Search package info by name, if it finds the package, return the package info.
-// if not found it will return similar package names.
-// if there is no similar package names, it will return empty string slice.
+// if not found it will return the packages which match the name in their names, keywords,
+// GitHub topics, descriptions and GitHub descriptions, ranked by the weighted score.
+// if there is no matched package, it will return empty slice.
 // if possibles is 0, it will only return exact match.
 func (r *Roster) SearchPackage(name string, possibles int) (*PackageSearchResult, error) {
 	nfo, err := r.LoadPackageMeta(name)
@@ -146,30 +148,28 @@ func (r *Roster) SearchPackage(name string, possibles int) (*PackageSearchResult
 	if possibles == 0 {
 		return ret, nil
 	}
-	// search similar package names
+	query := strings.ToLower(strings.TrimSpace(name))
+	terms := searchTokens(query)
 	candidates := []*PackageSearch{}
 	r.WalkPackageCache(func(nm string) bool {
-		if !r.experimental {
-			// skip alpha version on non-experimental mode
-			cache, err := r.LoadPackageCache(nm)
-			if err != nil {
-				return true
-			}
-			if strings.Contains(cache.LatestVersion, "alpha") {
-				return true
-			}
+		if ret.ExactMatch != nil && ret.ExactMatch.FullName() == nm {
+			return true
 		}
-		if ret.ExactMatch != nil && ret.ExactMatch.Name == nm {
+		cache, err := r.LoadPackageCache(nm)
+		if err != nil {
 			return true
 		}
-		score := CompareTwoStrings(strings.ToLower(nm), name)
-		if score > 0.1 {
-			cache, err := r.LoadPackageCache(nm)
-			if err != nil || !cache.Support(runtime.GOOS, runtime.GOARCH) {
-				return true
-			}
-			candidates = append(candidates, &PackageSearch{Name: nm, Score: score, Cache: cache})
+		if !r.experimental && strings.Contains(cache.LatestVersion, "alpha") {
+			// skip alpha version on non-experimental mode
+			return true
 		}
+		meta, _ := r.LoadPackageMeta(nm)
+		score, matched := searchScore(query, terms, searchFields(nm, meta, cache))
+		if score <= 0 || !cache.Support(runtime.GOOS, runtime.GOARCH) {
+			return true
+		}
+		cache.Matched = matched
+		candidates = append(candidates, &PackageSearch{Name: nm, Score: score, Cache: cache})
 		return true
 	})
 
@@ -179,7 +179,7 @@ func (r *Roster) SearchPackage(name string, possibles int) (*PackageSearchResult
 		} else if a.Score < b.Score {
 			return 1
 		}
-		return 0
+		return strings.Compare(a.Name, b.Name)
 	})
 	if len(candidates) > possibles {
 		candidates = candidates[:possibles]
@@ -189,3 +189,113 @@ func (r *Roster) SearchPackage(name string, possibles int) (*PackageSearchResult
 	}
 	return ret, nil
 }
+
+type SearchField string
+
+const (
+	SEARCH_NAME               SearchField = "name"
+	SEARCH_KEYWORDS           SearchField = "keywords"
+	SEARCH_TOPICS             SearchField = "topics"
+	SEARCH_DESCRIPTION        SearchField = "description"
+	SEARCH_GITHUB_DESCRIPTION SearchField = "github_description"
+)
+
+// searchWeights are the weights of the matches in the fields,
+// in the fixed order so that the sum of the scores does not depend on the map order.
+var searchWeights = []struct {
+	field  SearchField
+	weight float32
+}{
+	{SEARCH_NAME, 4},
+	{SEARCH_KEYWORDS, 3},
+	{SEARCH_TOPICS, 2.5},
+	{SEARCH_DESCRIPTION, 1.5},
+	{SEARCH_GITHUB_DESCRIPTION, 1},
+}
+
+// searchFields returns the words of the searchable fields of the package.
+func searchFields(name string, meta *PackageMeta, cache *PackageCache) map[SearchField][]string {
+	ret := map[SearchField][]string{
+		SEARCH_NAME: searchTokens(strings.ToLower(name)),
+	}
+	if meta != nil {
+		ret[SEARCH_KEYWORDS] = searchTokens(strings.ToLower(strings.Join(meta.Keywords, " ")))
+		ret[SEARCH_DESCRIPTION] = searchTokens(strings.ToLower(meta.Description))
+	}
+	if cache.Github != nil {
+		ret[SEARCH_TOPICS] = searchTokens(strings.ToLower(strings.Join(cache.Github.Topics, " ")))
+		ret[SEARCH_GITHUB_DESCRIPTION] = searchTokens(strings.ToLower(cache.Github.Description))
+	}
+	return ret
+}
+
+// searchTokens splits the text into the words, the words shorter than 2 letters are ignored.
+func searchTokens(text string) []string {
+	ret := []string{}
+	for _, word := range strings.FieldsFunc(text, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	}) {
+		if len(word) >= 2 && !slices.Contains(ret, word) {
+			ret = append(ret, word)
+		}
+	}
+	return ret
+}
+
+// searchScore scores the package for the query, and returns the matched words of the fields.
+// The whole name is matched by exact, prefix and fuzzy comparisons,
+// and each term of the query is matched with the words of the fields by exact, prefix and fuzzy comparisons.
+func searchScore(query string, terms []string, fields map[SearchField][]string) (float32, map[SearchField][]string) {
+	var score float32
+	matched := map[SearchField][]string{}
+	// the query is normalized as the name, e.g. 'labs/de' to 'labs-de'
+	name, queryName := strings.Join(fields[SEARCH_NAME], "-"), strings.Join(terms, "-")
+	if queryName == "" {
+		// the words are too short to be terms, e.g. 'm'
+		queryName = query
+	}
+	switch {
+	case name == queryName:
+		score += 10
+		matched[SEARCH_NAME] = fields[SEARCH_NAME]
+	case strings.HasPrefix(name, queryName):
+		score += 5
+		matched[SEARCH_NAME] = fields[SEARCH_NAME]
+	default:
+		// fuzzy, e.g. typos
+		if sim := CompareTwoStrings(name, queryName); sim > 0.3 {
+			score += 2 * sim
+			matched[SEARCH_NAME] = fields[SEARCH_NAME]
+		}
+	}
+	for _, term := range terms {
+		for _, fw := range searchWeights {
+			field, words := fw.field, fields[fw.field]
+			var best float32
+			var bestWord string
+			for _, word := range words {
+				var m float32
+				switch {
+				case word == term:
+					m = 1
+				case strings.HasPrefix(word, term):
+					m = 0.6
+				case len(term) >= 4:
+					if sim := CompareTwoStrings(word, term); sim >= 0.7 {
+						m = 0.4 * sim
+					}
+				}
+				if m > best {
+					best, bestWord = m, word
+				}
+			}
+			if best > 0 {
+				score += fw.weight * best
+				if !slices.Contains(matched[field], bestWord) {
+					matched[field] = append(matched[field], bestWord)
+				}
+			}
+		}
+	}
+	return score, matched
+}
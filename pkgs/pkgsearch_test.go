@@ -0,0 +1,85 @@
+package pkgs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchText(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"mqttbridge-1.0.0.tar.gz": {},
+		"sensorhub-1.0.0.tar.gz":  {},
+		"dashkit-1.0.0.tar.gz":    {},
+		"plotter-1.0.0.tar.gz":    {},
+	})
+	writeMeta := func(pkgName string, meta string) {
+		require.NoError(t, os.WriteFile(testMetaPath(roster, pkgName), []byte(meta), 0644))
+	}
+	writeMeta("sensorhub", "distributable:\n  github: machbase/sensorhub\n"+
+		"description: collects sensor data over MQTT and stores it into machbase\n")
+	writeMeta("dashkit", "distributable:\n  github: machbase/dashkit\n"+
+		"description: widgets for web pages\nkeywords: [dashboard, chart]\n")
+	writeMeta("plotter", "distributable:\n  github: machbase/plotter\n"+
+		"description: draws charts\n")
+	cache, err := roster.LoadPackageCache("plotter")
+	require.NoError(t, err)
+	cache.Github.Description = "Dashboards of time series"
+	cache.Github.Topics = []string{"dashboard", "grafana"}
+	require.NoError(t, WritePackageCacheFile(filepath.Join(roster.metaDir, string(ROSTER_CENTRAL), ".cache", "plotter", "cache.yml"), cache))
+
+	names := func(result *PackageSearchResult) []string {
+		ret := []string{}
+		for _, p := range result.Possibles {
+			ret = append(ret, p.FullName())
+		}
+		return ret
+	}
+
+	// the name ranks over the description
+	result, err := roster.SearchPackage("mqtt", 10)
+	require.NoError(t, err)
+	require.Nil(t, result.ExactMatch)
+	require.Equal(t, []string{"mqttbridge", "sensorhub"}, names(result))
+	require.Equal(t, []string{"mqttbridge"}, result.Possibles[0].Matched[SEARCH_NAME])
+	require.Equal(t, []string{"mqtt"}, result.Possibles[1].Matched[SEARCH_DESCRIPTION])
+
+	// the keywords rank over the topics and the GitHub description
+	result, err = roster.SearchPackage("dashboard", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dashkit", "plotter"}, names(result))
+	require.Equal(t, []string{"dashboard"}, result.Possibles[0].Matched[SEARCH_KEYWORDS])
+	require.Equal(t, []string{"dashboard"}, result.Possibles[1].Matched[SEARCH_TOPICS])
+	require.Equal(t, []string{"dashboards"}, result.Possibles[1].Matched[SEARCH_GITHUB_DESCRIPTION])
+
+	// fuzzy match of a typo
+	result, err = roster.SearchPackage("sensrhub", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"sensorhub"}, names(result))
+
+	// the exact match is not in the possibles
+	result, err = roster.SearchPackage("plotter", 10)
+	require.NoError(t, err)
+	require.NotNil(t, result.ExactMatch)
+	require.Empty(t, result.Possibles)
+
+	// the prefix of the name of the package of the other roster
+	require.NoError(t, roster.AddRoster("labs", "https://example.com/labs.git"))
+	writeTestPackage(t, roster.baseDir, "labs", "delta", "")
+	result, err = roster.SearchPackage("labs/de", 10)
+	require.NoError(t, err)
+	require.Nil(t, result.ExactMatch)
+	require.Equal(t, "labs/delta", names(result)[0])
+	require.Equal(t, []string{"labs", "delta"}, result.Possibles[0].Matched[SEARCH_NAME])
+	fields := searchFields("labs/delta", nil, result.Possibles[0])
+	prefixScore, _ := searchScore("labs/de", searchTokens("labs/de"), fields)
+	otherScore, _ := searchScore("labs/xy", searchTokens("labs/xy"), fields)
+	require.GreaterOrEqual(t, prefixScore-otherScore, float32(5))
+	// the score does not depend on the map order
+	for i := 0; i < 10; i++ {
+		score, _ := searchScore("labs/de", searchTokens("labs/de"), fields)
+		require.Equal(t, prefixScore, score)
+	}
+}
@@ -1,66 +1,305 @@
 package pkgs
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"time"
 )
 
-func (r *Roster) Uninstall(name string, output io.Writer, env []string) error {
-	meta, err := r.LoadPackageMeta(name)
+// WithPurge makes Uninstall remove everything of the package,
+// including the data_dirs and config_dirs of the package.yml which are kept by default.
+func WithPurge() OpOption {
+	return func(o *opOptions) {
+		o.purge = true
+	}
+}
+
+// UninstallPlan is the paths which Uninstall removes and keeps.
+type UninstallPlan struct {
+	PkgName string   `json:"pkg_name"`
+	Version string   `json:"version"`
+	Current bool     `json:"current"` // the version is the installed one
+	Remove  []string `json:"remove"`
+	Keep    []string `json:"keep,omitempty"` // the data and config dirs
+	// Dependents are the plans of the dependents which WithCascade() uninstalls first, in that order.
+	Dependents []*UninstallPlan `json:"dependents,omitempty"`
+}
+
+// splitPkgVersion splits 'pkg@version' into the package name and the version.
+func splitPkgVersion(name string) (string, string) {
+	pkgName, version, _ := strings.Cut(name, "@")
+	return pkgName, version
+}
+
+// PlanUninstall returns the paths which Uninstall(name, ...opts) will remove, without removing them.
+// The name is '<pkg>' or '<pkg>@<version>' to remove a version which is retained in the package dir.
+//
+// By default the version dir is removed except the data_dirs and config_dirs of the package.yml.
+// With WithPurge(), the version dir is removed entirely, and the whole package dir
+// including the other versions and the script logs if no version is given.
+//
+// It returns the DependentsError as Uninstall does if the other installed packages depend on the package,
+// with WithCascade() the plan has the plans of the dependents.
+func (r *Roster) PlanUninstall(name string, opts ...OpOption) (*UninstallPlan, error) {
+	o := makeOpOptions(opts)
+	plan, err := r.planUninstall(name, o)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	dependents, err := r.uninstallDependents(plan, o)
+	if err != nil {
+		return nil, err
+	}
+	for _, dep := range dependents {
+		depPlan, err := r.planUninstall(dep, o)
+		if err != nil {
+			return nil, fmt.Errorf("uninstall dependent %q: %w", dep, err)
+		}
+		plan.Dependents = append(plan.Dependents, depPlan)
 	}
-	inst, err := r.InstalledVersion(name)
+	return plan, nil
+}
+
+// uninstallDependents returns the dependents of the package to uninstall before it, in that order.
+// If the version of the plan is the installed one, and the other installed packages depend on it,
+// it returns the DependentsError unless WithForce() ignores them or WithCascade() uninstalls them.
+func (r *Roster) uninstallDependents(plan *UninstallPlan, o *opOptions) ([]string, error) {
+	if !plan.Current || o.force {
+		return nil, nil
+	}
+	tree, err := r.ReverseDependsTree(plan.PkgName)
 	if err != nil {
-		return err
-	}
-
-	if meta.UninstallRecipe != nil {
-		uninstallRun := FindScript(meta.UninstallRecipe.Scripts, runtime.GOOS)
-		if runtime.GOOS == "windows" {
-			if sc, err := MakeScriptFile([]string{uninstallRun}, inst.Path, "__uninstall__.cmd"); err != nil {
-				return err
-			} else {
-				cmd := exec.Command("cmd", "/c", sc)
-				cmd.Dir = inst.Path
-				cmd.Stdout = output
-				cmd.Stderr = output
-				cmd.Env = append(os.Environ(), env...)
-				err = cmd.Run()
-				if err != nil {
-					return err
-				}
-				os.Remove(filepath.Join(inst.Path, "__uninstall__.cmd"))
+		return nil, err
+	}
+	dependents := tree.UninstallOrder()
+	if len(dependents) > 0 && !o.cascade {
+		return nil, &DependentsError{PkgName: plan.PkgName, Dependents: dependents}
+	}
+	return dependents, nil
+}
+
+func (r *Roster) planUninstall(name string, opts *opOptions) (*UninstallPlan, error) {
+	pkgName, version := splitPkgVersion(name)
+	inst, instErr := r.InstalledVersion(pkgName)
+	if version == "" {
+		if instErr != nil {
+			return nil, instErr
+		}
+		version = inst.Version
+	}
+	switch version {
+	case ".", "..", "current", "wip", "logs":
+		return nil, fmt.Errorf("invalid version %q", version)
+	}
+	if filepath.Base(version) != version {
+		return nil, fmt.Errorf("invalid version %q", version)
+	}
+	pkgDir := r.pkgDir(pkgName)
+	verDir := filepath.Join(pkgDir, version)
+	if stat, err := os.Stat(verDir); err != nil || !stat.IsDir() {
+		return nil, fmt.Errorf("version %q of %q not found", version, pkgName)
+	}
+	ret := &UninstallPlan{
+		PkgName: pkgName,
+		Version: version,
+		Current: inst != nil && inst.Version == version,
+	}
+	if ret.Current {
+		ret.Remove = append(ret.Remove, inst.CurrentPath)
+	}
+	if opts.purge {
+		if _, v := splitPkgVersion(name); v == "" {
+			paths, err := r.purgePaths(pkgName)
+			if err != nil {
+				return nil, err
 			}
+			ret.Remove = append(ret.Remove, paths...)
 		} else {
-			if sc, err := MakeScriptFile([]string{uninstallRun}, inst.Path, "__uninstall__.sh"); err != nil {
-				return err
-			} else {
-				cmd := exec.Command("sh", "-c", sc)
-				cmd.Dir = inst.Path
-				cmd.Stdout = output
-				cmd.Stderr = output
-				cmd.Env = append(os.Environ(), env...)
-				err = cmd.Run()
-				if err != nil {
-					return err
-				}
-				os.Remove(filepath.Join(inst.Path, "__uninstall__.sh"))
+			ret.Remove = append(ret.Remove, verDir)
+		}
+		return ret, nil
+	}
+
+	meta, err := r.LoadPackageMeta(pkgName)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := keptPaths(meta, verDir)
+	if err != nil {
+		return nil, err
+	}
+	keep := []string{}
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err == nil {
+			keep = append(keep, path)
+		}
+	}
+	if len(keep) == 0 {
+		ret.Remove = append(ret.Remove, verDir)
+		return ret, nil
+	}
+	remove, err := removablePaths(verDir, keep)
+	if err != nil {
+		return nil, err
+	}
+	ret.Remove = append(ret.Remove, remove...)
+	ret.Keep = keep
+	return ret, nil
+}
+
+// purgePaths returns the paths of the package dir which WithPurge() removes without a version,
+// the package dir itself unless it is also the dir of the roster of the same name.
+func (r *Roster) purgePaths(pkgName string) ([]string, error) {
+	pkgDir := r.pkgDir(pkgName)
+	rosterName, _ := RosterNames(pkgName)
+	if _, ok := r.rosterRepos[RosterName(pkgName)]; rosterName != ROSTER_CENTRAL || !ok {
+		return []string{pkgDir}, nil
+	}
+	entries, err := os.ReadDir(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, entry := range entries {
+		path := filepath.Join(pkgDir, entry.Name())
+		if entry.IsDir() && entry.Name() != "logs" && isPkgDir(path) {
+			// the package of the roster
+			continue
+		}
+		ret = append(ret, path)
+	}
+	return ret, nil
+}
+
+// removablePaths returns the entries of the dir which can be removed without removing the keep paths.
+// keptPaths returns the paths of the data_dirs and config_dirs of the package.yml in the version dir,
+// which are kept by Uninstall and moved into the new version dir by the upgrades.
+func keptPaths(meta *PackageMeta, verDir string) ([]string, error) {
+	ret := []string{}
+	if meta == nil {
+		return ret, nil
+	}
+	for _, dir := range append(slices.Clone(meta.DataDirs), meta.ConfigDirs...) {
+		path := filepath.Join(verDir, filepath.FromSlash(dir))
+		if !strings.HasPrefix(path, verDir+string(filepath.Separator)) {
+			return nil, fmt.Errorf("invalid data or config dir %q", dir)
+		}
+		ret = append(ret, path)
+	}
+	return ret, nil
+}
+
+func removablePaths(dir string, keep []string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if slices.Contains(keep, path) {
+			continue
+		}
+		parent := slices.ContainsFunc(keep, func(k string) bool {
+			return strings.HasPrefix(k, path+string(filepath.Separator))
+		})
+		if parent && entry.IsDir() {
+			sub, err := removablePaths(path, keep)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, sub...)
+			continue
+		}
+		ret = append(ret, path)
+	}
+	return ret, nil
+}
+
+// Uninstall removes the package, or a version of it if the name is '<pkg>@<version>'.
+// See PlanUninstall() for the paths which are removed.
+func (r *Roster) Uninstall(name string, output io.Writer, env []string, opts ...OpOption) error {
+	return r.UninstallContext(context.Background(), name, output, env, opts...)
+}
+
+// UninstallContext is Uninstall with the ctx which cancels the uninstall script.
+//
+// If the other installed packages depend on the installed version of the package, it fails with
+// the DependentsError, unless WithForce() ignores them or WithCascade() uninstalls them first.
+func (r *Roster) UninstallContext(ctx context.Context, name string, output io.Writer, env []string, opts ...OpOption) error {
+	o := makeOpOptions(opts)
+	pkgName, _ := splitPkgVersion(name)
+	if plan, err := r.planUninstall(name, o); err == nil {
+		dependents, err := r.uninstallDependents(plan, o)
+		if err != nil {
+			o.emitResult("uninstall", pkgName, nil, err)
+			return err
+		}
+		for _, dep := range dependents {
+			if err := r.uninstall(ctx, dep, output, env, o); err != nil {
+				return fmt.Errorf("uninstall dependent %q: %w", dep, err)
 			}
 		}
 	}
+	return r.uninstall(ctx, name, output, env, o)
+}
 
-	if !filepath.IsAbs(inst.Path) || !strings.HasPrefix(inst.Path, r.distDir) {
-		return fmt.Errorf("invalid installed path: %q", inst.Path)
+func (r *Roster) uninstall(ctx context.Context, name string, output io.Writer, env []string, o *opOptions) error {
+	pkgName, version := splitPkgVersion(name)
+	entry := &HistoryEntry{Time: time.Now(), Action: HISTORY_UNINSTALL, PkgName: pkgName, FromVersion: version}
+	if inst, err := r.InstalledVersion(pkgName); err == nil && version == "" {
+		entry.FromVersion = inst.Version
 	}
-	if err := os.RemoveAll(inst.Path); err != nil {
-		return err
+	o.emit(&Event{Type: EVENT_STARTED, Op: "uninstall", PkgName: pkgName})
+	output, flush := o.output("uninstall", pkgName, output)
+	plan, err := r.uninstall0(ctx, name, output, env, o)
+	flush()
+	o.emitResult("uninstall", pkgName, plan, err)
+	entry.Duration = time.Since(entry.Time).Seconds()
+	entry.Success = err == nil
+	if err != nil {
+		entry.Error = err.Error()
 	}
-	os.RemoveAll(filepath.Dir(inst.Path))
+	r.journal(entry)
 	return err
 }
+
+func (r *Roster) uninstall0(ctx context.Context, name string, output io.Writer, env []string, opts *opOptions) (*UninstallPlan, error) {
+	plan, err := r.planUninstall(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := r.LoadPackageMeta(plan.PkgName)
+	if err != nil {
+		return nil, err
+	}
+	pkgDir := r.pkgDir(plan.PkgName)
+	verDir := filepath.Join(pkgDir, plan.Version)
+
+	// the uninstall script is for the installed version
+	if plan.Current && meta != nil && meta.UninstallRecipe != nil {
+		uninstallRun := FindPlatformScript(meta.UninstallRecipe.Scripts, runtime.GOOS)
+		if err := r.runScript(ctx, plan.PkgName, uninstallRun, verDir, "uninstall", output, env); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range plan.Remove {
+		if !filepath.IsAbs(path) || !strings.HasPrefix(path, r.distDir+string(filepath.Separator)) {
+			return nil, fmt.Errorf("invalid installed path: %q", path)
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return nil, err
+		}
+	}
+	// the dirs are removed only if they are empty, e.g. the package dir keeps the script logs
+	os.Remove(verDir)
+	os.Remove(pkgDir)
+	return plan, nil
+}
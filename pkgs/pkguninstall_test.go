@@ -0,0 +1,126 @@
+package pkgs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUninstallKeepAndPurge(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+	})
+	appendTestMeta(t, roster, "alpha", "data_dirs:\n  - data\nconfig_dirs:\n  - etc/conf\n")
+
+	inst := installTestPackage(t, roster, "alpha")
+	verDir := inst.Path
+	for _, f := range []string{"data/db.txt", "etc/conf/app.conf", "etc/other.conf"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(verDir, f)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(verDir, f), []byte(f), 0644))
+	}
+	// a version retained in the package dir
+	oldDir := filepath.Join(roster.pkgDir("alpha"), "0.9.0")
+	require.NoError(t, os.MkdirAll(oldDir, 0755))
+
+	require.NoError(t, roster.Uninstall("alpha@0.9.0", io.Discard, nil))
+	_, err := os.Stat(oldDir)
+	require.True(t, os.IsNotExist(err))
+	_, err = roster.InstalledVersion("alpha")
+	require.NoError(t, err)
+	require.Error(t, roster.Uninstall("alpha@0.9.0", io.Discard, nil))
+	require.Error(t, roster.Uninstall("alpha@..", io.Discard, nil))
+
+	plan, err := roster.PlanUninstall("alpha")
+	require.NoError(t, err)
+	require.True(t, plan.Current)
+	require.Equal(t, []string{filepath.Join(verDir, "data"), filepath.Join(verDir, "etc", "conf")}, plan.Keep)
+	require.Equal(t, []string{
+		inst.CurrentPath,
+		filepath.Join(verDir, MANIFEST_FILE),
+		filepath.Join(verDir, "etc", "other.conf"),
+		filepath.Join(verDir, "index.html"),
+	}, plan.Remove)
+	// the plan does not remove anything
+	_, err = os.Stat(filepath.Join(verDir, "index.html"))
+	require.NoError(t, err)
+
+	require.NoError(t, roster.Uninstall("alpha", io.Discard, nil))
+	_, err = roster.InstalledVersion("alpha")
+	require.Error(t, err)
+	for _, f := range []string{"data/db.txt", "etc/conf/app.conf"} {
+		_, err := os.Stat(filepath.Join(verDir, f))
+		require.NoError(t, err, f)
+	}
+	for _, f := range []string{"index.html", "etc/other.conf"} {
+		_, err := os.Stat(filepath.Join(verDir, f))
+		require.True(t, os.IsNotExist(err), f)
+	}
+
+	// the kept data is in place after reinstall, and purge removes everything
+	inst = installTestPackage(t, roster, "alpha")
+	content, err := os.ReadFile(filepath.Join(inst.CurrentPath, "data", "db.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "data/db.txt", string(content))
+	plan, err = roster.PlanUninstall("alpha", WithPurge())
+	require.NoError(t, err)
+	require.Equal(t, []string{inst.CurrentPath, roster.pkgDir("alpha")}, plan.Remove)
+	require.NoError(t, roster.Uninstall("alpha", io.Discard, nil, WithPurge()))
+	_, err = os.Stat(roster.pkgDir("alpha"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestUpgradeKeepsDataDirs(t *testing.T) {
+	roster, svr := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "1.0.0", "etc/conf/app.conf": "default"}),
+		"alpha_2.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "2.0.0", "etc/conf/app.conf": "default"}),
+	})
+	appendTestMeta(t, roster, "alpha", "data_dirs:\n  - data\n  - data/logs\nconfig_dirs:\n  - etc/conf\n")
+	setUrl := func(name string) {
+		cache, err := roster.LoadPackageCache("alpha")
+		require.NoError(t, err)
+		cache.Url = svr.URL + "/" + name
+		require.NoError(t, roster.WritePackageCache(cache))
+	}
+	readFile := func(inst *InstalledVersion, name string) string {
+		content, err := os.ReadFile(filepath.Join(inst.CurrentPath, filepath.FromSlash(name)))
+		require.NoError(t, err, name)
+		return string(content)
+	}
+
+	old := installTestPackage(t, roster, "alpha")
+	for f, content := range map[string]string{"data/db.txt": "db", "data/logs/app.log": "log", "etc/conf/app.conf": "mine"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(old.Path, f)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(old.Path, f), []byte(content), 0644))
+	}
+
+	// the upgrade moves the data and config dirs into the new version
+	setUrl("alpha_2.0.0.tar.gz")
+	inst := installTestPackage(t, roster, "alpha")
+	require.Equal(t, "alpha_2.0.0", inst.Version)
+	require.Equal(t, "2.0.0", readFile(inst, "index.html"))
+	require.Equal(t, "db", readFile(inst, "data/db.txt"))
+	require.Equal(t, "log", readFile(inst, "data/logs/app.log"))
+	require.Equal(t, "mine", readFile(inst, "etc/conf/app.conf"))
+	_, err := os.Stat(old.Path)
+	require.True(t, os.IsNotExist(err))
+
+	// the changes of the data are not a drift
+	require.NoError(t, os.WriteFile(filepath.Join(inst.Path, "data", "db.txt"), []byte("db2"), 0644))
+	result, err := roster.Verify("alpha")
+	require.NoError(t, err)
+	require.Empty(t, result.Modified)
+	require.Empty(t, result.Unexpected)
+
+	// installing another version after uninstall takes the kept dirs of the uninstalled version
+	require.NoError(t, roster.Uninstall("alpha", io.Discard, nil))
+	setUrl("alpha-1.0.0.tar.gz")
+	inst = installTestPackage(t, roster, "alpha")
+	require.Equal(t, "1.0.0", readFile(inst, "index.html"))
+	require.Equal(t, "db2", readFile(inst, "data/db.txt"))
+	require.Equal(t, "mine", readFile(inst, "etc/conf/app.conf"))
+	_, err = os.Stat(filepath.Join(roster.pkgDir("alpha"), "alpha_2.0.0"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,105 @@
+package pkgs
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// VerifyResult is the result of Verify().
+// The paths are relative to the version directory and separated by '/'.
+type VerifyResult struct {
+	PkgName    string   `json:"pkg_name"`
+	Version    string   `json:"version"`
+	Path       string   `json:"path"`
+	Modified   []string `json:"modified,omitempty"`   // content, mode or link target changed
+	Missing    []string `json:"missing,omitempty"`    // in the manifest, but not on disk
+	Unexpected []string `json:"unexpected,omitempty"` // on disk, but not in the manifest
+}
+
+// Clean reports whether the installed files are the same as the manifest.
+func (vr *VerifyResult) Clean() bool {
+	return len(vr.Modified) == 0 && len(vr.Missing) == 0 && len(vr.Unexpected) == 0
+}
+
+// Verify re-hashes the files of the installed package and compares them with the install manifest.
+// The data_dirs of the package.yml are excluded, their files are changed at runtime.
+// It returns an error if the package is not installed or was installed without the manifest.
+func (r *Roster) Verify(pkgName string) (*VerifyResult, error) {
+	inst, err := r.InstalledVersion(pkgName)
+	if err != nil {
+		return nil, err
+	}
+	if inst.ManifestPath == "" {
+		return nil, fmt.Errorf("package %q has no manifest, reinstall it", pkgName)
+	}
+	manifest, err := inst.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := r.LoadPackageMeta(pkgName)
+	if err != nil {
+		return nil, err
+	}
+	dataDirs := []string{}
+	if meta != nil {
+		for _, dir := range meta.DataDirs {
+			dataDirs = append(dataDirs, path.Clean(filepath.ToSlash(dir)))
+		}
+	}
+	inDataDirs := func(p string) bool {
+		return slices.ContainsFunc(dataDirs, func(dir string) bool {
+			return p == dir || strings.HasPrefix(p, dir+"/")
+		})
+	}
+	files, err := ScanManifestFiles(inst.Path)
+	if err != nil {
+		return nil, err
+	}
+	files = slices.DeleteFunc(files, func(f *ManifestFile) bool { return inDataDirs(f.Path) })
+	ret := &VerifyResult{PkgName: pkgName, Version: inst.Version, Path: inst.Path}
+	onDisk := map[string]*ManifestFile{}
+	for _, f := range files {
+		onDisk[f.Path] = f
+	}
+	expected := map[string]bool{}
+	for _, want := range manifest.Files {
+		if inDataDirs(want.Path) {
+			continue
+		}
+		expected[want.Path] = true
+		got, ok := onDisk[want.Path]
+		if !ok {
+			ret.Missing = append(ret.Missing, want.Path)
+		} else if !sameManifestFile(want, got) {
+			ret.Modified = append(ret.Modified, want.Path)
+		}
+	}
+	for _, f := range files {
+		if !expected[f.Path] {
+			ret.Unexpected = append(ret.Unexpected, f.Path)
+		}
+	}
+	return ret, nil
+}
+
+func sameManifestFile(want, got *ManifestFile) bool {
+	if want.Mode.Type() != got.Mode.Type() {
+		return false
+	}
+	// windows does not keep the unix permissions
+	if runtime.GOOS != "windows" && want.Mode.Perm() != got.Mode.Perm() {
+		return false
+	}
+	switch {
+	case want.Mode&fs.ModeSymlink != 0:
+		return filepath.ToSlash(want.Link) == got.Link
+	case want.Mode.IsRegular():
+		return want.Size == got.Size && want.Sha256 == got.Sha256
+	}
+	return true
+}
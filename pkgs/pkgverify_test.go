@@ -0,0 +1,42 @@
+package pkgs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	archive := makeTarGz(t, map[string]string{"index.html": "alpha", "bin/run.sh": "#!/bin/sh\n"})
+	roster, _ := newTestRoster(t, map[string][]byte{"alpha-1.0.0.tar.gz": archive})
+	inst := installTestPackage(t, roster, "alpha")
+
+	result, err := roster.Verify("alpha")
+	require.NoError(t, err)
+	require.True(t, result.Clean())
+
+	require.NoError(t, os.WriteFile(filepath.Join(inst.Path, "index.html"), []byte("beta!"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(inst.Path, "bin", "run.sh")))
+	require.NoError(t, os.WriteFile(filepath.Join(inst.Path, "extra.txt"), []byte("extra"), 0644))
+	result, err = roster.Verify("alpha")
+	require.NoError(t, err)
+	require.False(t, result.Clean())
+	require.Equal(t, []string{"index.html"}, result.Modified)
+	require.Equal(t, []string{"bin/run.sh"}, result.Missing)
+	require.Equal(t, []string{"extra.txt"}, result.Unexpected)
+
+	// the files of the data dirs are changed at runtime
+	appendTestMeta(t, roster, "alpha", "data_dirs:\n  - bin\n")
+	require.NoError(t, os.WriteFile(filepath.Join(inst.Path, "bin", "db.txt"), []byte("db"), 0644))
+	result, err = roster.Verify("alpha")
+	require.NoError(t, err)
+	require.Empty(t, result.Missing)
+	require.Equal(t, []string{"extra.txt"}, result.Unexpected)
+
+	// no manifest
+	require.NoError(t, os.Remove(inst.ManifestPath))
+	_, err = roster.Verify("alpha")
+	require.ErrorContains(t, err, "no manifest")
+}
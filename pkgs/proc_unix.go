@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package pkgs
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// processAlive reports whether the process of the pid is running.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM: the process exists but belongs to another user
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// killProcessGroupOnCancel runs the cmd in a new process group,
+// and kills the whole group when the context of the cmd is done.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,137 @@
+package pkgs
+
+import (
+	"io"
+	"time"
+)
+
+type InstallPhase string
+
+const (
+	PHASE_RESOLVE  InstallPhase = "resolve"
+	PHASE_DOWNLOAD InstallPhase = "download"
+	PHASE_VERIFY   InstallPhase = "verify"
+	PHASE_EXTRACT  InstallPhase = "extract"
+	PHASE_SCRIPT   InstallPhase = "script"
+	PHASE_LINK     InstallPhase = "link"
+)
+
+// InstallProgress is reported to the ProgressObserver while a package is being installed.
+// BytesDone, BytesTotal, Rate and ETA are meaningful only in the download phase,
+// BytesTotal is 0 if the size of the archive is unknown.
+type InstallProgress struct {
+	PkgName    string        `json:"pkg_name"`
+	Phase      InstallPhase  `json:"phase"`
+	BytesDone  int64         `json:"bytes_done"`
+	BytesTotal int64         `json:"bytes_total"`
+	Rate       float64       `json:"rate"` // bytes per second
+	ETA        time.Duration `json:"eta"`
+}
+
+type ProgressObserver interface {
+	OnProgress(p *InstallProgress)
+}
+
+// ProgressFunc is an adapter to allow the use of ordinary functions as ProgressObserver.
+type ProgressFunc func(p *InstallProgress)
+
+func (f ProgressFunc) OnProgress(p *InstallProgress) {
+	f(p)
+}
+
+// OpOption configures a single roster operation such as Install.
+type OpOption func(*opOptions)
+
+type opOptions struct {
+	progress    ProgressObserver
+	checksum    string // expected checksum of the archive
+	archivePath string // local archive file to install instead of downloading
+	events      EventObserver
+	purge       bool // uninstall removes the data and config dirs too
+	force       bool // uninstall ignores the dependents
+	cascade     bool // uninstall removes the dependents first
+}
+
+func makeOpOptions(opts []OpOption) *opOptions {
+	ret := &opOptions{}
+	for _, o := range opts {
+		o(ret)
+	}
+	return ret
+}
+
+func WithProgress(obs ProgressObserver) OpOption {
+	return func(o *opOptions) {
+		o.progress = obs
+	}
+}
+
+// WithChecksum sets the expected sha256 digest (hex or base64 encoded) of the archive to install.
+func WithChecksum(digest string) OpOption {
+	return func(o *opOptions) {
+		o.checksum = digest
+	}
+}
+
+func (o *opOptions) reportPhase(pkgName string, phase InstallPhase) {
+	o.OnProgress(&InstallProgress{PkgName: pkgName, Phase: phase})
+}
+
+// OnProgress forwards the progress to the progress observer and the event observer.
+func (o *opOptions) OnProgress(p *InstallProgress) {
+	if o.progress != nil {
+		o.progress.OnProgress(p)
+	}
+	o.emit(&Event{Type: EVENT_PROGRESS, Op: "install", PkgName: p.PkgName, Progress: p})
+}
+
+const progressInterval = 250 * time.Millisecond
+
+// progressReader counts the bytes read through it and reports the download progress
+// to the observer at most once in every progressInterval.
+type progressReader struct {
+	r          io.Reader
+	pkgName    string
+	observer   ProgressObserver
+	total      int64
+	done       int64
+	started    time.Time
+	lastReport time.Time
+}
+
+func newProgressReader(r io.Reader, pkgName string, total int64, observer ProgressObserver) *progressReader {
+	now := time.Now()
+	return &progressReader{r: r, pkgName: pkgName, total: total, observer: observer, started: now, lastReport: now}
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.done += int64(n)
+	if err == io.EOF {
+		pr.report()
+	} else if time.Since(pr.lastReport) >= progressInterval {
+		pr.report()
+	}
+	return n, err
+}
+
+func (pr *progressReader) report() {
+	if pr.observer == nil {
+		return
+	}
+	now := time.Now()
+	pr.lastReport = now
+	ret := &InstallProgress{
+		PkgName:    pr.pkgName,
+		Phase:      PHASE_DOWNLOAD,
+		BytesDone:  pr.done,
+		BytesTotal: pr.total,
+	}
+	if elapsed := now.Sub(pr.started).Seconds(); elapsed > 0 {
+		ret.Rate = float64(pr.done) / elapsed
+	}
+	if ret.Rate > 0 && pr.total > pr.done {
+		ret.ETA = time.Duration(float64(pr.total-pr.done) / ret.Rate * float64(time.Second))
+	}
+	pr.observer.OnProgress(ret)
+}
@@ -0,0 +1,29 @@
+package pkgs
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressReader(t *testing.T) {
+	reports := []*InstallProgress{}
+	observer := ProgressFunc(func(p *InstallProgress) {
+		reports = append(reports, p)
+	})
+	content := strings.Repeat("0123456789", 1000)
+	pr := newProgressReader(strings.NewReader(content), "test-pkg", int64(len(content)), observer)
+	n, err := io.Copy(io.Discard, pr)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), n)
+
+	require.NotEmpty(t, reports)
+	last := reports[len(reports)-1]
+	require.Equal(t, "test-pkg", last.PkgName)
+	require.Equal(t, PHASE_DOWNLOAD, last.Phase)
+	require.Equal(t, int64(len(content)), last.BytesDone)
+	require.Equal(t, int64(len(content)), last.BytesTotal)
+	require.Zero(t, last.ETA)
+}
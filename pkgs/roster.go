@@ -1,11 +1,17 @@
 package pkgs
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/machbase/neo-pkgdev/pkgs/untar"
 )
 
 type RosterName string
@@ -17,11 +23,21 @@ var ROSTER_REPOS = map[RosterName]string{
 }
 
 type Roster struct {
+	baseDir             string
 	metaDir             string
 	distDir             string
 	log                 Logger
 	syncWhenInitialized bool
 	experimental        bool
+	applyLock           sync.Mutex    // serializes extracting and install scripts
+	historyLock         sync.Mutex    // serializes writing the history journal
+	holdsLock           sync.Mutex    // serializes updating the held packages
+	rostersLock         sync.Mutex    // serializes updating the added rosters
+	extractLimits       untar.Options // limits of extracting the archives
+	workTimeout         time.Duration // the 'wip' marker older than this is stale
+	maxScriptLogs       int           // number of script logs kept per package
+	rosterRepos         map[RosterName]string
+	archiveStore        *ArchiveStore // downloaded archives shared by the base dirs, nil if disabled
 }
 
 type RosterOption func(*Roster)
@@ -36,8 +52,29 @@ func NewRoster(baseDir string, opts ...RosterOption) (*Roster, error) {
 	distDir := filepath.Join(baseDir, "dist")
 
 	ret := &Roster{
-		metaDir: metaDir,
-		distDir: distDir,
+		baseDir:       baseDir,
+		metaDir:       metaDir,
+		distDir:       distDir,
+		extractLimits: untar.DefaultOptions(),
+		workTimeout:   DEFAULT_WORK_TIMEOUT,
+		maxScriptLogs: DEFAULT_MAX_SCRIPT_LOGS,
+		rosterRepos:   map[RosterName]string{},
+	}
+	for name, repo := range ROSTER_REPOS {
+		ret.rosterRepos[name] = repo
+	}
+	// the rosters added by AddRoster(), WithRosterRepo() overrides them
+	if repos, err := ret.readRosters(); err != nil {
+		return nil, err
+	} else {
+		for name, repo := range repos {
+			if name != ROSTER_CENTRAL {
+				ret.rosterRepos[name] = repo
+			}
+		}
+	}
+	if dir, err := DefaultArchiveStoreDir(); err == nil {
+		ret.archiveStore = NewArchiveStore(dir, DEFAULT_ARCHIVE_STORE_SIZE)
 	}
 	for _, opt := range opts {
 		opt(ret)
@@ -54,8 +91,11 @@ func NewRoster(baseDir string, opts ...RosterOption) (*Roster, error) {
 			initialized = true
 		}
 	}
+	if !initialized {
+		ret.migrateLayout()
+	}
 	if initialized && ret.syncWhenInitialized {
-		if err := ret.Sync(ROSTER_CENTRAL, ROSTER_REPOS[ROSTER_CENTRAL]); err != nil {
+		if err := ret.Sync(ROSTER_CENTRAL, ret.rosterRepos[ROSTER_CENTRAL]); err != nil {
 			// keep going, we can not stop if the sync fails by some reason.
 			ret.log.Errorf("Sync error: %s roster %s", ROSTER_CENTRAL, err)
 		}
@@ -75,6 +115,46 @@ func WithSyncWhenInitialized(flag bool) RosterOption {
 	}
 }
 
+// WithExtractLimits sets the limits of extracting the package archives,
+// StripComponents of the limits is ignored, it comes from the package.
+func WithExtractLimits(limits untar.Options) RosterOption {
+	return func(r *Roster) {
+		r.extractLimits = limits
+	}
+}
+
+// WithWorkTimeout sets the age after which an unfinished install is considered as abandoned,
+// the default is DEFAULT_WORK_TIMEOUT. 0 disables the timeout.
+func WithWorkTimeout(timeout time.Duration) RosterOption {
+	return func(r *Roster) {
+		r.workTimeout = timeout
+	}
+}
+
+// WithRosterRepo adds the roster of the git repository, the packages of the roster
+// are named '<rosterName>/<pkgName>' and installed into 'dist/<rosterName>/<pkgName>'.
+func WithRosterRepo(rosterName RosterName, repoUrl string) RosterOption {
+	return func(r *Roster) {
+		r.rosterRepos[rosterName] = repoUrl
+	}
+}
+
+// WithMaxScriptLogs sets the number of script logs kept per package,
+// the default is DEFAULT_MAX_SCRIPT_LOGS. 0 keeps all logs.
+func WithMaxScriptLogs(n int) RosterOption {
+	return func(r *Roster) {
+		r.maxScriptLogs = n
+	}
+}
+
+// WithArchiveStore sets the store of the downloaded archives, nil disables it.
+// The default is the store in DefaultArchiveStoreDir() capped at DEFAULT_ARCHIVE_STORE_SIZE.
+func WithArchiveStore(store *ArchiveStore) RosterOption {
+	return func(r *Roster) {
+		r.archiveStore = store
+	}
+}
+
 func WithExperimental(flag bool) RosterOption {
 	return func(r *Roster) {
 		r.experimental = flag
@@ -83,59 +163,205 @@ func WithExperimental(flag bool) RosterOption {
 
 type Updates struct {
 	Upgradable []*Upgradable `json:"upgradable"`
+	Held       []*Upgradable `json:"held,omitempty"` // newer versions which are not allowed by the holds
 }
 
 type Upgradable struct {
 	PkgName          string `json:"pkg_name"`
 	LatestRelease    string `json:"latest_release"`
 	InstalledVersion string `json:"installed_version"`
+	Hold             string `json:"hold,omitempty"` // the version or the constraint of the hold
 }
 
 func (r *Roster) Update() (*Updates, error) {
+	return r.UpdateContext(context.Background())
+}
+
+// UpdateContext is Update with the ctx which cancels the git operations.
+func (r *Roster) UpdateContext(ctx context.Context) (*Updates, error) {
 	ret := &Updates{}
 
-	syncStat, err := r.SyncCheck()
+	syncStat, err := r.SyncCheckContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, stat := range syncStat {
 		if stat.NeedSync {
-			if err := r.Sync(RosterName(stat.RosterName), ROSTER_REPOS[RosterName(stat.RosterName)]); err != nil {
+			if err := r.SyncContext(ctx, RosterName(stat.RosterName), r.rosterRepos[RosterName(stat.RosterName)]); err != nil {
 				return nil, err
 			}
 		}
+	}
+
+	ret.Upgradable, ret.Held, err = r.upgradables()
+	return ret, err
+}
 
-		r.WalkPackageMeta(func(name string) bool {
-			cache, err := r.LoadPackageCache(name)
-			if err != nil {
-				// failed to update cache
+// upgradables returns the installed packages which have the newer version in the roster cache,
+// and the packages whose newer version is not allowed by the hold.
+// The versions are compared as the semantic versions, so that the downgrades and
+// the same versions in the different formats are not offered.
+func (r *Roster) upgradables() ([]*Upgradable, []*Upgradable, error) {
+	holds, err := r.Holds()
+	if err != nil {
+		return nil, nil, err
+	}
+	ret, held := []*Upgradable{}, []*Upgradable{}
+	r.WalkPackageMeta(func(name string) bool {
+		cache, err := r.LoadPackageCache(name)
+		if err != nil {
+			// failed to update cache
+			return true
+		}
+		instVer, err := r.InstalledVersion(name)
+		if err != nil {
+			// not installed or error
+			return true
+		}
+		latestVersion := cache.Version()
+		if cmp, err := CompareVersions(instVer.Version, latestVersion); err != nil {
+			// not comparable, e.g. a version without the number
+			if latestVersion == instVer.Version {
 				return true
 			}
-			instVer, err := r.InstalledVersion(name)
-			if err != nil {
-				// not installed or error
-				instVer = nil
+		} else if cmp >= 0 {
+			return true
+		}
+		upgradable := &Upgradable{
+			PkgName:          name,
+			LatestRelease:    latestVersion,
+			InstalledVersion: instVer.Version,
+		}
+		if idx := slices.IndexFunc(holds, func(h *PackageHold) bool { return h.PkgName == name }); idx >= 0 {
+			if hold := holds[idx]; !hold.Allows(latestVersion) {
+				upgradable.Hold = hold.String()
+				held = append(held, upgradable)
+				return true
+			}
+		}
+		ret = append(ret, upgradable)
+		return true
+	})
+	return ret, held, nil
+}
+
+// LoadPackageMeta loads package.yml of the package '<pkgName>' of the central roster,
+// or '<rosterName>/<pkgName>' of the other roster.
+func (r *Roster) LoadPackageMeta(pkgName string) (*PackageMeta, error) {
+	rosterName, name := RosterNames(pkgName)
+	return r.LoadPackageMetaRoster(rosterName, name)
+}
+
+// rosters returns the names of the rosters, the central roster comes first.
+func (r *Roster) rosters() []RosterName {
+	ret := []RosterName{ROSTER_CENTRAL}
+	others := []RosterName{}
+	for name := range r.rosterRepos {
+		if name != ROSTER_CENTRAL {
+			others = append(others, name)
+		}
+	}
+	slices.Sort(others)
+	return append(ret, others...)
+}
+
+// pkgDir returns the directory where the package is installed,
+// 'dist/<pkgName>' for the central roster, otherwise 'dist/<rosterName>/<pkgName>'.
+func (r *Roster) pkgDir(pkgName string) string {
+	rosterName, name := RosterNames(pkgName)
+	if rosterName == ROSTER_CENTRAL {
+		return filepath.Join(r.distDir, name)
+	}
+	return filepath.Join(r.distDir, string(rosterName), name)
+}
+
+// walkPkgDirs calls cb with the name and the dir of every package dir in the distDir,
+// including the packages of the other rosters in 'dist/<rosterName>/'.
+// If 'dist/<rosterName>' is also the dir of the central package of the same name,
+// only its sub dirs which are package dirs belong to the roster, the others are the versions of the central package.
+func (r *Roster) walkPkgDirs(cb func(pkgName string, pkgDir string)) error {
+	entries, err := os.ReadDir(r.distDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		rosterName := RosterName(entry.Name())
+		if _, ok := r.rosterRepos[rosterName]; !ok || rosterName == ROSTER_CENTRAL {
+			cb(entry.Name(), filepath.Join(r.distDir, entry.Name()))
+			continue
+		}
+		dir := filepath.Join(r.distDir, entry.Name())
+		central := isPkgDir(dir)
+		if central {
+			cb(entry.Name(), dir)
+		}
+		subEntries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, sub := range subEntries {
+			subDir := filepath.Join(dir, sub.Name())
+			if !sub.IsDir() || (central && !isPkgDir(subDir)) {
+				continue
+			}
+			cb(fmt.Sprintf("%s/%s", rosterName, sub.Name()), subDir)
+		}
+	}
+	return nil
+}
+
+// migrateLayout moves the packages of the other rosters which were installed into 'dist/<pkgName>'
+// by the old versions to 'dist/<rosterName>/<pkgName>'.
+func (r *Roster) migrateLayout() {
+	for _, rosterName := range r.rosters()[1:] {
+		entries, err := os.ReadDir(filepath.Join(r.metaDir, string(rosterName), "projects"))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			oldDir := filepath.Join(r.distDir, name)
+			newDir := r.pkgDir(fmt.Sprintf("%s/%s", rosterName, name))
+			if _, err := os.Lstat(filepath.Join(oldDir, "current")); err != nil {
+				continue
 			}
-			latestVersion := cache.LatestVersion
-			if instVer != nil {
-				// installed
-				if latestVersion != instVer.Version {
-					ret.Upgradable = append(ret.Upgradable, &Upgradable{
-						PkgName:          name,
-						LatestRelease:    latestVersion,
-						InstalledVersion: instVer.Version,
-					})
-				}
+			if _, err := os.Stat(newDir); err == nil {
+				continue
 			}
-			return true
-		})
+			if meta, err := r.LoadPackageMetaRoster(ROSTER_CENTRAL, name); err != nil || meta != nil {
+				// the package of the central roster
+				continue
+			}
+			if err := r.movePkgDir(oldDir, newDir); err != nil {
+				r.log.Errorf("migrate %s/%s: %v", rosterName, name, err)
+			} else {
+				r.log.Infof("migrated %s to %s", oldDir, newDir)
+			}
+		}
 	}
-	return ret, nil
 }
 
-func (r *Roster) LoadPackageMeta(pkgName string) (*PackageMeta, error) {
-	return r.LoadPackageMetaRoster(ROSTER_CENTRAL, pkgName)
+// movePkgDir moves the package dir and relinks its 'current' link to the moved version dir.
+func (r *Roster) movePkgDir(oldDir, newDir string) error {
+	current, err := Readlink(filepath.Join(oldDir, "current"))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(newDir), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(oldDir, newDir); err != nil {
+		return err
+	}
+	currentLink := filepath.Join(newDir, "current")
+	if err := os.Remove(currentLink); err != nil {
+		return err
+	}
+	return Symlink(filepath.Join(newDir, filepath.Base(current)), currentLink)
 }
 
 // LoadPackageMetaRoster loads package.yml file from the given package name.
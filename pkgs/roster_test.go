@@ -0,0 +1,91 @@
+package pkgs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradables(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+	})
+	installTestPackage(t, roster, "alpha")
+	// the version dir 'alpha-1.0.0' is the same version as '1.0.0'
+	upgradables, _, err := roster.upgradables()
+	require.NoError(t, err)
+	require.Empty(t, upgradables)
+
+	for _, tc := range []struct {
+		latest     string
+		upgradable bool
+	}{
+		{"v1.0", false},
+		{"0.9.0", false},
+		{"1.0.1", true},
+	} {
+		setTestLatest(t, roster, "alpha", tc.latest)
+		upgradables, _, err := roster.upgradables()
+		require.NoError(t, err)
+		if !tc.upgradable {
+			require.Empty(t, upgradables, tc.latest)
+			continue
+		}
+		require.Len(t, upgradables, 1)
+		require.Equal(t, "alpha", upgradables[0].PkgName)
+		require.Equal(t, "alpha-1.0.0", upgradables[0].InstalledVersion)
+		require.Equal(t, tc.latest, upgradables[0].LatestRelease)
+	}
+}
+
+func TestAddRoster(t *testing.T) {
+	base, svr := newTestRoster(t, map[string][]byte{
+		"alpha-1.0.0.tar.gz": makeTarGz(t, map[string]string{"index.html": "alpha"}),
+		"delta.tar.gz":       makeTarGz(t, map[string]string{"index.html": "delta"}),
+		"labsdist.tar.gz":    makeTarGz(t, map[string]string{"index.html": "labs"}),
+	})
+	require.ErrorContains(t, base.AddRoster("alpha", "https://example.com/alpha.git"), `conflicts with the package "alpha"`)
+	require.ErrorContains(t, base.AddRoster(ROSTER_CENTRAL, "https://example.com/central.git"), "built in")
+	require.ErrorContains(t, base.AddRoster("../labs", "https://example.com/labs.git"), "invalid roster name")
+	require.NoError(t, base.AddRoster("labs", "https://example.com/labs.git"))
+	writeTestPackage(t, base.baseDir, "labs", "delta", svr.URL+"/delta.tar.gz")
+
+	// the added roster is kept in the base dir
+	roster, err := NewRoster(base.baseDir, WithArchiveStore(nil))
+	require.NoError(t, err)
+	require.Equal(t, []*RosterRepo{
+		{Name: ROSTER_CENTRAL, RepoUrl: ROSTER_REPOS[ROSTER_CENTRAL]},
+		{Name: "labs", RepoUrl: "https://example.com/labs.git"},
+	}, roster.Rosters())
+	installTestPackage(t, roster, "labs/delta")
+	require.ErrorContains(t, roster.RemoveRoster("labs"), "labs/delta")
+
+	// the central roster has got the package of the same name as the roster later
+	writeTestPackage(t, base.baseDir, ROSTER_CENTRAL, "labs", svr.URL+"/labsdist.tar.gz")
+	inst := installTestPackage(t, roster, "labs")
+	require.Equal(t, filepath.Join(roster.distDir, "labs", "labsdist"), inst.Path)
+	installed, err := roster.InstalledPackages()
+	require.NoError(t, err)
+	require.Equal(t, []string{"labs", "labs/delta"}, installed.Installed)
+	found, err := roster.Doctor(false)
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	// purging the central package keeps the packages of the roster
+	require.NoError(t, roster.Uninstall("labs", io.Discard, nil, WithPurge()))
+	inst, err = roster.InstalledVersion("labs/delta")
+	require.NoError(t, err)
+	require.Equal(t, "delta", inst.Version)
+	_, err = os.Stat(filepath.Join(roster.distDir, "labs", "labsdist"))
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, roster.Uninstall("labs/delta", io.Discard, nil))
+	require.NoError(t, roster.RemoveRoster("labs"))
+	require.ErrorContains(t, roster.RemoveRoster("labs"), "not added")
+	roster, err = NewRoster(base.baseDir, WithArchiveStore(nil))
+	require.NoError(t, err)
+	require.Len(t, roster.Rosters(), 1)
+}
@@ -0,0 +1,170 @@
+package pkgs
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const ROSTER_CONFIG_FILE = "roster.yml"
+
+// DEFAULT_ARTIFACT_REGION is the region of the bucket if the region is not set,
+// S3 compatible stores like MinIO accept it as well.
+const DEFAULT_ARTIFACT_REGION = "us-east-1"
+
+// RosterConfig is the roster.yml at the root of the roster repository.
+type RosterConfig struct {
+	Artifacts *ArtifactConfig `yaml:"artifacts,omitempty" json:"artifacts,omitempty"`
+}
+
+// ArtifactConfig is where the built archives of the packages are uploaded to and downloaded from.
+//
+//	artifacts:
+//	  base_url: https://example.com/neo-pkg/{{.org}}/{{.repo}}/{{.file}}
+//	  bucket: my-bucket
+//	  region: us-east-1
+//	  endpoint: http://127.0.0.1:9000
+//	  prefix: neo-pkg
+//
+// base_url is a template of the download url, the variables are 'org', 'repo', 'file', 'version', 'os' and 'arch'.
+// If base_url has no template action, '/<org>/<repo>/<file>' is appended to it.
+// If base_url is empty, it is the url of the bucket, the endpoint is used instead of AWS S3 if it is set.
+// The region defaults to DEFAULT_ARTIFACT_REGION.
+type ArtifactConfig struct {
+	BaseUrl  string `yaml:"base_url,omitempty" json:"base_url,omitempty"`
+	Bucket   string `yaml:"bucket,omitempty" json:"bucket,omitempty"`
+	Region   string `yaml:"region,omitempty" json:"region,omitempty"`
+	Endpoint string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+	Prefix   string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+}
+
+// DefaultArtifactConfig returns the artifact store of the central roster.
+func DefaultArtifactConfig() *ArtifactConfig {
+	return &ArtifactConfig{
+		Bucket: "p-edge-packages",
+		Region: "ap-northeast-2",
+		Prefix: "neo-pkg",
+	}
+}
+
+var regionRegexp = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// Validate checks that the artifact store is configured and its urls and region are valid.
+func (ac *ArtifactConfig) Validate() error {
+	if ac.BaseUrl == "" && ac.Bucket == "" {
+		return fmt.Errorf("artifacts has neither base_url nor bucket")
+	}
+	if strings.Contains(ac.BaseUrl, "{{") {
+		if _, err := template.New("url").Parse(ac.BaseUrl); err != nil {
+			return fmt.Errorf("invalid base_url %q, %w", ac.BaseUrl, err)
+		}
+	} else if ac.BaseUrl != "" {
+		if err := validHttpUrl(ac.BaseUrl); err != nil {
+			return fmt.Errorf("invalid base_url %q, %w", ac.BaseUrl, err)
+		}
+	}
+	if ac.Endpoint != "" {
+		if err := validHttpUrl(ac.Endpoint); err != nil {
+			return fmt.Errorf("invalid endpoint %q, %w", ac.Endpoint, err)
+		}
+	}
+	if ac.Region != "" && !regionRegexp.MatchString(ac.Region) {
+		return fmt.Errorf("invalid region %q", ac.Region)
+	}
+	return nil
+}
+
+func validHttpUrl(str string) error {
+	u, err := url.Parse(str)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme is not http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("no host")
+	}
+	return nil
+}
+
+// S3Region returns the region of the bucket, DEFAULT_ARTIFACT_REGION if it is not set.
+func (ac *ArtifactConfig) S3Region() string {
+	if ac.Region == "" {
+		return DEFAULT_ARTIFACT_REGION
+	}
+	return ac.Region
+}
+
+// ObjectKey returns the key of the archive file in the bucket.
+func (ac *ArtifactConfig) ObjectKey(org string, repo string, file string) string {
+	return path.Join(ac.Prefix, org, repo, file)
+}
+
+// DownloadUrl returns the url of the archive file.
+func (ac *ArtifactConfig) DownloadUrl(org string, repo string, file string, vars map[string]string) (string, error) {
+	if strings.Contains(ac.BaseUrl, "{{") {
+		all := map[string]string{"org": org, "repo": repo, "file": file}
+		for k, v := range vars {
+			all[k] = v
+		}
+		return renderUrlTemplate(ac.BaseUrl, all)
+	}
+	base := ac.BaseUrl
+	if base == "" {
+		if ac.Bucket == "" {
+			return "", fmt.Errorf("artifact store is not configured")
+		}
+		if ac.Endpoint != "" {
+			// path-style, e.g. MinIO
+			base = fmt.Sprintf("%s/%s", strings.TrimSuffix(ac.Endpoint, "/"), ac.Bucket)
+		} else {
+			base = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", ac.Bucket, ac.S3Region())
+		}
+		if ac.Prefix != "" {
+			base = base + "/" + strings.Trim(ac.Prefix, "/")
+		}
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", strings.TrimSuffix(base, "/"), org, repo, file), nil
+}
+
+// LoadRosterConfigFile reads the roster.yml in the rosterDir,
+// the artifacts default to DefaultArtifactConfig() if the file or the section does not exist.
+// It returns an error if the artifacts are not valid.
+func LoadRosterConfigFile(rosterDir string) (*RosterConfig, error) {
+	ret := &RosterConfig{}
+	content, err := os.ReadFile(filepath.Join(rosterDir, ROSTER_CONFIG_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(content, ret); err != nil {
+			return nil, fmt.Errorf("invalid %s, %w", ROSTER_CONFIG_FILE, err)
+		}
+	}
+	if ret.Artifacts == nil {
+		ret.Artifacts = DefaultArtifactConfig()
+	}
+	if err := ret.Artifacts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s, %w", ROSTER_CONFIG_FILE, err)
+	}
+	return ret, nil
+}
+
+// RosterDirOf returns the roster dir of the package.yml or the cache.yml of a package,
+// '<rosterDir>/projects/<pkgName>/package.yml' or '<rosterDir>/.cache/<pkgName>/cache.yml'.
+func RosterDirOf(path string) string {
+	return filepath.Join(filepath.Dir(path), "..", "..")
+}
+
+// LoadRosterConfig reads the roster.yml of the roster.
+func (r *Roster) LoadRosterConfig(rosterName RosterName) (*RosterConfig, error) {
+	return LoadRosterConfigFile(filepath.Join(r.metaDir, string(rosterName)))
+}
@@ -0,0 +1,74 @@
+package pkgs
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactConfig(t *testing.T) {
+	for _, tc := range []struct {
+		conf   ArtifactConfig
+		expect string
+	}{
+		{*DefaultArtifactConfig(), "https://p-edge-packages.s3.ap-northeast-2.amazonaws.com/neo-pkg/machbase/echo/echo-1.0.0.tar.gz"},
+		{ArtifactConfig{Bucket: "pkgs", Endpoint: "http://127.0.0.1:9000/", Prefix: "/neo/"}, "http://127.0.0.1:9000/pkgs/neo/machbase/echo/echo-1.0.0.tar.gz"},
+		{ArtifactConfig{Bucket: "pkgs"}, "https://pkgs.s3.us-east-1.amazonaws.com/machbase/echo/echo-1.0.0.tar.gz"},
+		{ArtifactConfig{BaseUrl: "http://example.com/dist/"}, "http://example.com/dist/machbase/echo/echo-1.0.0.tar.gz"},
+		{ArtifactConfig{BaseUrl: "http://example.com/{{.repo}}/{{.version}}/{{.file}}"}, "http://example.com/echo/1.0.0/echo-1.0.0.tar.gz"},
+	} {
+		u, err := tc.conf.DownloadUrl("machbase", "echo", "echo-1.0.0.tar.gz", map[string]string{"version": "1.0.0"})
+		require.NoError(t, err)
+		require.Equal(t, tc.expect, u)
+	}
+	_, err := (&ArtifactConfig{}).DownloadUrl("machbase", "echo", "echo-1.0.0.tar.gz", nil)
+	require.Error(t, err)
+	require.Equal(t, DEFAULT_ARTIFACT_REGION, (&ArtifactConfig{Bucket: "pkgs", Endpoint: "http://127.0.0.1:9000"}).S3Region())
+
+	// the roster.yml is validated when it is loaded
+	rosterDir := t.TempDir()
+	for conf, expect := range map[string]string{
+		"artifacts:\n  prefix: neo-pkg\n":                                 "neither base_url nor bucket",
+		"artifacts:\n  base_url: example.com/dist\n":                      "invalid base_url",
+		"artifacts:\n  base_url: http://example.com/{{.repo\n":            "invalid base_url",
+		"artifacts:\n  bucket: pkgs\n  endpoint: 127.0.0.1:9000\n":        "invalid endpoint",
+		"artifacts:\n  bucket: pkgs\n  region: ap northeast\n":            "invalid region",
+		"artifacts:\n  bucket: pkgs\n  endpoint: http://127.0.0.1:9000\n": "",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(rosterDir, ROSTER_CONFIG_FILE), []byte(conf), 0644))
+		_, err := LoadRosterConfigFile(rosterDir)
+		if expect == "" {
+			require.NoError(t, err, conf)
+		} else {
+			require.ErrorContains(t, err, expect, conf)
+		}
+	}
+	require.Equal(t, rosterDir, RosterDirOf(filepath.Join(rosterDir, "projects", "echo", "package.yml")))
+	require.Equal(t, rosterDir, RosterDirOf(filepath.Join(rosterDir, ".cache", "echo", "cache.yml")))
+
+	// the artifact store is a plain directory served over http
+	roster, _ := newTestRoster(t, nil)
+	writeTestPackage(t, roster.baseDir, ROSTER_CENTRAL, "echo", "")
+	archive := makeTarGz(t, map[string]string{"index.html": "echo"})
+	sum := sha256.Sum256(archive)
+	store := newTestArtifactStore(t, roster, map[string][]byte{
+		"machbase/echo/echo-1.0.0.tar.gz":     archive,
+		"machbase/echo/echo-1.0.0.tar.gz.sum": []byte(base64.StdEncoding.EncodeToString(sum[:])),
+	})
+
+	cache, err := roster.LoadPackageCache("echo")
+	require.NoError(t, err)
+	dist, err := cache.RemoteDistribution()
+	require.NoError(t, err)
+	require.Len(t, dist, 1)
+	require.Equal(t, store.URL+"/machbase/echo/echo-1.0.0.tar.gz", dist[0].Url)
+
+	inst := installTestPackage(t, roster, "echo")
+	content, err := os.ReadFile(filepath.Join(inst.CurrentPath, "index.html"))
+	require.NoError(t, err)
+	require.Equal(t, "echo", string(content))
+}
@@ -0,0 +1,141 @@
+package pkgs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ROSTERS_FILE is the name of the file of the rosters added by AddRoster() in the base dir.
+const ROSTERS_FILE = "rosters.yml"
+
+// RosterRepo is a roster and the url of its git repository.
+type RosterRepo struct {
+	Name    RosterName `json:"name"`
+	RepoUrl string     `json:"repo_url"`
+}
+
+// AddRoster adds the roster of the git repository and keeps it in the base dir,
+// so the later rosters of the base dir know it without WithRosterRepo().
+// The packages of the roster are named '<rosterName>/<pkgName>', call Sync() to fetch them.
+func (r *Roster) AddRoster(rosterName RosterName, repoUrl string) error {
+	name := string(rosterName)
+	if name == "" || name == "." || name == ".." || strings.HasPrefix(name, ".") ||
+		filepath.Base(name) != name || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid roster name %q", name)
+	}
+	if rosterName == ROSTER_CENTRAL {
+		return fmt.Errorf("roster %q is built in", name)
+	}
+	if repoUrl == "" {
+		return fmt.Errorf("roster %q has no repository url", name)
+	}
+	// 'dist/<rosterName>' is shared with the central package of the same name
+	if meta, err := r.LoadPackageMetaRoster(ROSTER_CENTRAL, name); err != nil {
+		return err
+	} else if meta != nil || isPkgDir(filepath.Join(r.distDir, name)) {
+		return fmt.Errorf("roster name %q conflicts with the package %q", name, name)
+	}
+	r.rostersLock.Lock()
+	defer r.rostersLock.Unlock()
+	repos, err := r.readRosters()
+	if err != nil {
+		return err
+	}
+	repos[rosterName] = repoUrl
+	if err := r.writeRosters(repos); err != nil {
+		return err
+	}
+	r.rosterRepos[rosterName] = repoUrl
+	return nil
+}
+
+// RemoveRoster removes the roster added by AddRoster(), its meta dir and the script logs of its packages,
+// it returns an error if the packages of the roster are installed.
+func (r *Roster) RemoveRoster(rosterName RosterName) error {
+	r.rostersLock.Lock()
+	defer r.rostersLock.Unlock()
+	repos, err := r.readRosters()
+	if err != nil {
+		return err
+	}
+	if _, ok := repos[rosterName]; !ok {
+		return fmt.Errorf("roster %q is not added", rosterName)
+	}
+	installed := []string{}
+	err = r.walkPkgDirs(func(pkgName string, pkgDir string) {
+		if rn, _ := RosterNames(pkgName); rn == rosterName && isPkgDir(pkgDir) {
+			installed = append(installed, pkgName)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(installed) > 0 {
+		return fmt.Errorf("roster %q has the installed packages %s", rosterName, strings.Join(installed, ", "))
+	}
+	delete(repos, rosterName)
+	if err := r.writeRosters(repos); err != nil {
+		return err
+	}
+	delete(r.rosterRepos, rosterName)
+	if dir := filepath.Join(r.distDir, string(rosterName)); !isPkgDir(dir) {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(filepath.Join(r.metaDir, string(rosterName)))
+}
+
+// Rosters returns the rosters known to the roster, the central roster comes first.
+func (r *Roster) Rosters() []*RosterRepo {
+	ret := []*RosterRepo{}
+	for _, name := range r.rosters() {
+		ret = append(ret, &RosterRepo{Name: name, RepoUrl: r.rosterRepos[name]})
+	}
+	return ret
+}
+
+func (r *Roster) readRosters() (map[RosterName]string, error) {
+	ret := map[RosterName]string{}
+	content, err := os.ReadFile(filepath.Join(r.baseDir, ROSTERS_FILE))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(content, &ret); err != nil {
+		return nil, fmt.Errorf("invalid %s, %w", ROSTERS_FILE, err)
+	}
+	if ret == nil {
+		ret = map[RosterName]string{}
+	}
+	return ret, nil
+}
+
+func (r *Roster) writeRosters(repos map[RosterName]string) error {
+	content, err := yaml.Marshal(repos)
+	if err != nil {
+		return err
+	}
+	// replace the file at once, the other processes may be reading it
+	path := filepath.Join(r.baseDir, ROSTERS_FILE)
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// isPkgDir reports whether the dir is a package dir, which has the 'current' link or the 'wip' marker.
+func isPkgDir(dir string) bool {
+	for _, name := range []string{"current", "wip"} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package pkgs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// scriptWaitDelay is how long to wait for the output of the killed script to be closed.
+const scriptWaitDelay = 5 * time.Second
+
+// RunScript runs the script in the dir with the shell of the platform,
+// 'name' is used for the script file '__<name>__.sh' ('__<name>__.cmd' on Windows).
+// The script and all its child processes are killed when the ctx is done or the timeout of the script has passed.
+func RunScript(ctx context.Context, script Script, dir string, name string, output io.Writer, env []string) error {
+	if script.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, script.Timeout)
+		defer cancel()
+	}
+	var scriptFile string
+	if runtime.GOOS == "windows" {
+		scriptFile = fmt.Sprintf("__%s__.cmd", name)
+	} else {
+		scriptFile = fmt.Sprintf("__%s__.sh", name)
+	}
+	sc, err := MakeScriptFile([]string{script.Run}, dir, scriptFile)
+	if err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/c", sc)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", sc)
+	}
+	cmd.Dir = dir
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Env = append(os.Environ(), env...)
+	cmd.WaitDelay = scriptWaitDelay
+	killProcessGroupOnCancel(cmd)
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%s script: %w", name, ctxErr)
+		}
+		return err
+	}
+	os.Remove(filepath.Join(dir, scriptFile))
+	return nil
+}
@@ -0,0 +1,32 @@
+package pkgs
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available")
+	}
+	output := &bytes.Buffer{}
+	err := RunScript(context.Background(), Script{Run: "echo hello"}, t.TempDir(), "test", output, nil)
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", output.String())
+
+	// the child process holding the output is killed too
+	t0 := time.Now()
+	err = RunScript(context.Background(), Script{Run: "sleep 30 &\nsleep 30", Timeout: 200 * time.Millisecond}, t.TempDir(), "test", output, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(t0), scriptWaitDelay)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	err = RunScript(ctx, Script{Run: "sleep 30"}, t.TempDir(), "test", output, nil)
+	require.ErrorIs(t, err, context.Canceled)
+}
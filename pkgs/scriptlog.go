@@ -0,0 +1,85 @@
+package pkgs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DEFAULT_MAX_SCRIPT_LOGS is the default number of script logs kept per package.
+const DEFAULT_MAX_SCRIPT_LOGS = 20
+
+// OpenScriptLog creates the log file '<time>-<name>.log' in the dir,
+// and removes the oldest log files so that at most max files are kept.
+// If max <= 0, the old files are not removed.
+func OpenScriptLog(dir string, name string, max int) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	filename := fmt.Sprintf("%s-%s.log", time.Now().Format("20060102T150405.000"), name)
+	f, err := os.OpenFile(filepath.Join(dir, filename), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 {
+		if logs, err := ScriptLogFiles(dir); err == nil && len(logs) > max {
+			for _, old := range logs[:len(logs)-max] {
+				os.Remove(old)
+			}
+		}
+	}
+	return f, nil
+}
+
+// ScriptLogFiles returns the log files in the dir, the oldest first.
+func ScriptLogFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	ret := []string{}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".log") {
+			ret = append(ret, filepath.Join(dir, entry.Name()))
+		}
+	}
+	// the names start with the time
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// ScriptLogs returns the script log files of the package, the oldest first.
+func (r *Roster) ScriptLogs(pkgName string) ([]string, error) {
+	return ScriptLogFiles(r.scriptLogDir(pkgName))
+}
+
+func (r *Roster) scriptLogDir(pkgName string) string {
+	return filepath.Join(r.pkgDir(pkgName), "logs")
+}
+
+// runScript runs the script by RunScript, and keeps its output in the log file of the package.
+func (r *Roster) runScript(ctx context.Context, pkgName string, script Script, dir string, name string, output io.Writer, env []string) error {
+	logFile, err := OpenScriptLog(r.scriptLogDir(pkgName), name, r.maxScriptLogs)
+	if err != nil {
+		r.log.Warnf("script log: %v", err)
+		return RunScript(ctx, script, dir, name, output, env)
+	}
+	defer logFile.Close()
+	fmt.Fprintf(logFile, "# %s %s script in %s\n# %s\n", pkgName, name, dir, strings.ReplaceAll(script.Run, "\n", "\n# "))
+	t0 := time.Now()
+	err = RunScript(ctx, script, dir, name, io.MultiWriter(output, logFile), env)
+	if err != nil {
+		fmt.Fprintf(logFile, "# failed in %s: %v\n", time.Since(t0).Round(time.Millisecond), err)
+	} else {
+		fmt.Fprintf(logFile, "# done in %s\n", time.Since(t0).Round(time.Millisecond))
+	}
+	return err
+}
@@ -29,11 +29,15 @@ func Archive(cwd string, dest string, files []string) error {
 		tw = tar.NewWriter(destFile)
 	}
 	for _, file := range files {
-		stat, err := os.Stat(filepath.Join(cwd, file))
+		stat, err := os.Lstat(filepath.Join(cwd, file))
 		if err != nil {
 			return err
 		}
-		if stat.IsDir() {
+		if stat.Mode()&os.ModeSymlink != 0 {
+			if err := tarSymlink(tw, cwd, file, stat); err != nil {
+				return err
+			}
+		} else if stat.IsDir() {
 			if err := tarDir(tw, cwd, file, stat); err != nil {
 				return err
 			}
@@ -68,11 +72,15 @@ func tarDir(tw *tar.Writer, cwd string, path string, fi os.FileInfo) error {
 	}
 	for _, entry := range entries {
 		name := filepath.Join(path, entry.Name())
-		stat, err := os.Stat(filepath.Join(cwd, name))
+		stat, err := os.Lstat(filepath.Join(cwd, name))
 		if err != nil {
 			return err
 		}
-		if stat.IsDir() {
+		if stat.Mode()&os.ModeSymlink != 0 {
+			if err := tarSymlink(tw, cwd, name, stat); err != nil {
+				return err
+			}
+		} else if stat.IsDir() {
 			if err := tarDir(tw, cwd, name+string(filepath.Separator), stat); err != nil {
 				return err
 			}
@@ -114,3 +122,22 @@ func tarFile(tw *tar.Writer, cwd string, path string, fi os.FileInfo) error {
 	}
 	return nil
 }
+
+// tarSymlink archives the symlink itself instead of the file it points to.
+func tarSymlink(tw *tar.Writer, cwd string, path string, fi os.FileInfo) error {
+	link, err := os.Readlink(filepath.Join(cwd, path))
+	if err != nil {
+		return err
+	}
+	uid, gid := getUid(fi)
+	hdr := &tar.Header{
+		Typeflag: byte(tar.TypeSymlink),
+		Name:     filepath.ToSlash(path),
+		Linkname: filepath.ToSlash(link),
+		Mode:     int64(fi.Mode().Perm()),
+		ModTime:  fi.ModTime(),
+		Uid:      uid,
+		Gid:      gid,
+	}
+	return tw.WriteHeader(hdr)
+}
@@ -3,6 +3,8 @@ package tar_test
 import (
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -55,3 +57,27 @@ func TestArchive(t *testing.T) {
 	}
 
 }
+
+func TestArchiveSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on windows")
+	}
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "build", "lib"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "build", "lib", "libfoo.so.1"), []byte("libfoo"), 0644))
+	require.NoError(t, os.Symlink("libfoo.so.1", filepath.Join(src, "build", "lib", "libfoo.so")))
+
+	require.NoError(t, tar.Archive(src, "test.tar.gz", []string{"build/"}))
+	fd, err := os.Open(filepath.Join(src, "test.tar.gz"))
+	require.NoError(t, err)
+	defer fd.Close()
+
+	dest := t.TempDir()
+	require.NoError(t, untar.Untar(fd, dest, 1))
+	link, err := os.Readlink(filepath.Join(dest, "lib", "libfoo.so"))
+	require.NoError(t, err)
+	require.Equal(t, "libfoo.so.1", link)
+	content, err := os.ReadFile(filepath.Join(dest, "lib", "libfoo.so"))
+	require.NoError(t, err)
+	require.Equal(t, "libfoo", string(content))
+}
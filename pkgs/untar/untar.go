@@ -7,6 +7,9 @@ package untar
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
 	"errors"
 	"fmt"
@@ -17,6 +20,10 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/machbase/neo-pkgdev/pkgs/archivepath"
+	"github.com/ulikunitz/xz"
 )
 
 // TODO(bradfitz): this was copied from x/build/cmd/buildlet/buildlet.go
@@ -24,27 +31,93 @@ import (
 // forked for now.  Unfork and add some opts arguments here, so the
 // buildlet can use this code somehow.
 
-// Untar reads the gzip-compressed tar file from r and writes it into dir.
+// Untar reads the tar file from r and writes it into dir.
+// The tar file can be compressed by gzip, bzip2, xz or zstd, or not compressed at all.
 func Untar(r io.Reader, dir string, stripComponents int) error {
-	return untar(r, dir, stripComponents)
+	return untar(r, dir, Options{StripComponents: stripComponents})
 }
 
-func StripComponents(p string, stripComponents int) string {
-	if stripComponents == 0 {
-		return filepath.FromSlash(p)
+// UntarWithOptions is same as Untar, but it enforces the limits of the opts while extracting.
+func UntarWithOptions(r io.Reader, dir string, opts Options) error {
+	return untar(r, dir, opts)
+}
+
+// Options controls how Untar extracts the archive.
+// The zero value of a limit means unlimited.
+type Options struct {
+	StripComponents int
+	MaxTotalSize    int64 // max total uncompressed size of the files
+	MaxEntries      int   // max number of entries
+	MaxFileSize     int64 // max size of a single file
+	MaxPathDepth    int   // max number of path elements of an entry name
+}
+
+// DefaultOptions returns the options which have the limits
+// that are large enough for the packages.
+func DefaultOptions() Options {
+	return Options{
+		MaxTotalSize: 4 << 30, // 4 GiB
+		MaxEntries:   100000,
+		MaxFileSize:  2 << 30, // 2 GiB
+		MaxPathDepth: 64,
+	}
+}
+
+// LimitError is returned when the archive exceeds one of the limits of the Options.
+type LimitError struct {
+	Limit string // name of the limit, e.g. "MaxTotalSize"
+	Max   int64  // value of the limit
+	Entry string // name of the entry which exceeded the limit
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("archive entry %q exceeds the limit %s=%d", e.Entry, e.Limit, e.Max)
+}
+
+func (opts *Options) check(f *tar.Header, nEntries int, totalSize int64) error {
+	return opts.CheckEntry(f.Name, f.Typeflag == tar.TypeReg, f.Size, nEntries, totalSize)
+}
+
+// CheckEntry returns the LimitError if the entry exceeds the limits,
+// nEntries is the number of the entries including this one,
+// totalSize is the size of the regular files extracted before this one.
+// It is shared with the other archive formats, e.g. unzip.
+func (opts *Options) CheckEntry(name string, regular bool, size int64, nEntries int, totalSize int64) error {
+	if opts.MaxEntries > 0 && nEntries > opts.MaxEntries {
+		return &LimitError{Limit: "MaxEntries", Max: int64(opts.MaxEntries), Entry: name}
 	}
-	p = strings.TrimPrefix(p, "/")
-	for i := 0; i < stripComponents; i++ {
-		if j := strings.Index(p, "/"); j != -1 {
-			p = p[j+1:]
+	if opts.MaxPathDepth > 0 {
+		depth := 0
+		for _, elem := range strings.Split(name, "/") {
+			if elem != "" && elem != "." {
+				depth++
+			}
+		}
+		if depth > opts.MaxPathDepth {
+			return &LimitError{Limit: "MaxPathDepth", Max: int64(opts.MaxPathDepth), Entry: name}
 		}
 	}
-	return filepath.FromSlash(p)
+	if regular {
+		if opts.MaxFileSize > 0 && size > opts.MaxFileSize {
+			return &LimitError{Limit: "MaxFileSize", Max: opts.MaxFileSize, Entry: name}
+		}
+		if opts.MaxTotalSize > 0 && totalSize+size > opts.MaxTotalSize {
+			return &LimitError{Limit: "MaxTotalSize", Max: opts.MaxTotalSize, Entry: name}
+		}
+	}
+	return nil
+}
+
+// StripComponents removes the leading stripComponents path elements of the name, see archivepath.StripComponents.
+func StripComponents(p string, stripComponents int) string {
+	return archivepath.StripComponents(p, stripComponents)
 }
 
-func untar(r io.Reader, dir string, stripComponents int) (err error) {
+func untar(r io.Reader, dir string, opts Options) (err error) {
 	t0 := time.Now()
 	nFiles := 0
+	nEntries := 0
+	var totalSize int64
 	madeDir := map[string]bool{}
 	defer func() {
 		/*
@@ -56,10 +129,16 @@ func untar(r io.Reader, dir string, stripComponents int) (err error) {
 			}
 		*/
 	}()
-	zr, err := gzip.NewReader(r)
+	if abs, err := filepath.Abs(dir); err != nil {
+		return err
+	} else {
+		dir = abs
+	}
+	zr, closer, err := decompress(r)
 	if err != nil {
-		return fmt.Errorf("requires gzip-compressed body: %v", err)
+		return err
 	}
+	defer closer()
 	tr := tar.NewReader(zr)
 	loggedChtimesError := false
 	for {
@@ -71,12 +150,19 @@ func untar(r io.Reader, dir string, stripComponents int) (err error) {
 			//log.Printf("tar reading error: %v", err)
 			return fmt.Errorf("tar error: %v", err)
 		}
-		if !validRelPath(f.Name) {
+		if !archivepath.ValidRelPath(f.Name) {
 			return fmt.Errorf("tar contained invalid name error %q", f.Name)
 		}
-		rel := StripComponents(f.Name, stripComponents)
+		nEntries++
+		if err := opts.check(f, nEntries, totalSize); err != nil {
+			return err
+		}
+		rel := StripComponents(f.Name, opts.StripComponents)
 		abs := filepath.Join(dir, rel)
 		mode := f.FileInfo().Mode()
+		if err := archivepath.CheckNoSymlink(dir, abs); err != nil {
+			return err
+		}
 		switch f.Typeflag {
 		case tar.TypeReg:
 			// Make the directory. This is redundant because it should
@@ -102,6 +188,12 @@ func untar(r io.Reader, dir string, stripComponents int) (err error) {
 					return err
 				}
 			}
+			if fi, err := os.Lstat(abs); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				// never write through the symlink
+				if err := os.Remove(abs); err != nil {
+					return err
+				}
+			}
 			wf, err := os.OpenFile(abs, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode.Perm())
 			if err != nil {
 				return err
@@ -116,6 +208,7 @@ func untar(r io.Reader, dir string, stripComponents int) (err error) {
 			if n != f.Size {
 				return fmt.Errorf("only wrote %d bytes to %s; expected %d", n, abs, f.Size)
 			}
+			totalSize += n
 			modTime := f.ModTime
 			if modTime.After(t0) {
 				// Clamp modtimes at system time. See
@@ -142,6 +235,44 @@ func untar(r io.Reader, dir string, stripComponents int) (err error) {
 				return err
 			}
 			madeDir[abs] = true
+		case tar.TypeSymlink:
+			if !archivepath.ValidLinkTarget(dir, abs, f.Linkname) {
+				return fmt.Errorf("tar contained invalid symlink %q -> %q", f.Name, f.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+				return err
+			}
+			if err := os.Remove(abs); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if err := os.Symlink(filepath.FromSlash(f.Linkname), abs); err != nil {
+				return err
+			}
+			nFiles++
+		case tar.TypeLink:
+			if !archivepath.ValidRelPath(f.Linkname) {
+				return fmt.Errorf("tar contained invalid hardlink %q -> %q", f.Name, f.Linkname)
+			}
+			target := filepath.Join(dir, StripComponents(f.Linkname, opts.StripComponents))
+			if !archivepath.WithinDir(dir, target) {
+				return fmt.Errorf("tar contained invalid hardlink %q -> %q", f.Name, f.Linkname)
+			}
+			if err := archivepath.CheckNoSymlink(dir, target); err != nil {
+				return err
+			}
+			if fi, err := os.Lstat(target); err != nil || !fi.Mode().IsRegular() {
+				return fmt.Errorf("tar contained hardlink %q to non-regular file %q", f.Name, f.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+				return err
+			}
+			if err := os.Remove(abs); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if err := os.Link(target, abs); err != nil {
+				return err
+			}
+			nFiles++
 		case tar.TypeXGlobalHeader:
 			// git archive generates these. Ignore them.
 		default:
@@ -151,9 +282,41 @@ func untar(r io.Reader, dir string, stripComponents int) (err error) {
 	return nil
 }
 
-func validRelPath(p string) bool {
-	if p == "" || strings.Contains(p, `\`) || strings.HasPrefix(p, "/") || strings.Contains(p, "../") {
-		return false
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompress detects the compression of r by its magic bytes,
+// and returns the reader of the decompressed content.
+func decompress(r io.Reader) (io.Reader, func(), error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(6)
+	switch {
+	case bytes.HasPrefix(magic, magicGzip):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gzip error: %v", err)
+		}
+		return zr, func() { zr.Close() }, nil
+	case bytes.HasPrefix(magic, magicBzip2):
+		return bzip2.NewReader(br), func() {}, nil
+	case bytes.HasPrefix(magic, magicXz):
+		zr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xz error: %v", err)
+		}
+		return zr, func() {}, nil
+	case bytes.HasPrefix(magic, magicZstd):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("zstd error: %v", err)
+		}
+		return zr, zr.Close, nil
+	default:
+		// not compressed
+		return br, func() {}, nil
 	}
-	return true
 }
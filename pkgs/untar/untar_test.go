@@ -0,0 +1,176 @@
+package untar_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/machbase/neo-pkgdev/pkgs/untar"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+func makeTar(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "build/", Mode: 0755}))
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "build/" + name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func compress(t *testing.T, content []byte, newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := newWriter(buf)
+	require.NoError(t, err)
+	_, err = w.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestUntarCompressions(t *testing.T) {
+	plain := makeTar(t, map[string]string{"index.html": "hello"})
+	archives := map[string][]byte{
+		"tar": plain,
+		"gzip": compress(t, plain, func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		}),
+		"xz": compress(t, plain, func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		}),
+		"zstd": compress(t, plain, func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		}),
+	}
+	for name, archive := range archives {
+		dir := t.TempDir()
+		require.NoError(t, untar.Untar(bytes.NewReader(archive), dir, 1), name)
+		content, err := os.ReadFile(filepath.Join(dir, "index.html"))
+		require.NoError(t, err, name)
+		require.Equal(t, "hello", string(content), name)
+	}
+}
+
+func makeTarEntries(t *testing.T, headers []*tar.Header) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, hdr := range headers {
+		if hdr.Typeflag == tar.TypeReg {
+			content := "content of " + hdr.Name
+			hdr.Size = int64(len(content))
+			require.NoError(t, tw.WriteHeader(hdr))
+			_, err := tw.Write([]byte(content))
+			require.NoError(t, err)
+		} else {
+			require.NoError(t, tw.WriteHeader(hdr))
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestUntarLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on windows")
+	}
+	archive := makeTarEntries(t, []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "pkg/", Mode: 0755},
+		{Typeflag: tar.TypeDir, Name: "pkg/lib/", Mode: 0755},
+		{Typeflag: tar.TypeReg, Name: "pkg/lib/libfoo.so.1", Mode: 0644},
+		{Typeflag: tar.TypeSymlink, Name: "pkg/lib/libfoo.so", Linkname: "libfoo.so.1"},
+		{Typeflag: tar.TypeSymlink, Name: "pkg/libfoo.so", Linkname: "./lib/libfoo.so"},
+		{Typeflag: tar.TypeDir, Name: "pkg/bin/", Mode: 0755},
+		{Typeflag: tar.TypeSymlink, Name: "pkg/bin/lib", Linkname: "../lib"},
+		{Typeflag: tar.TypeLink, Name: "pkg/lib/libfoo.so.1.0", Linkname: "pkg/lib/libfoo.so.1"},
+	})
+	dir := t.TempDir()
+	require.NoError(t, untar.Untar(bytes.NewReader(archive), dir, 1))
+
+	for _, path := range []string{"lib/libfoo.so", "libfoo.so", "bin/lib/libfoo.so.1", "lib/libfoo.so.1.0"} {
+		content, err := os.ReadFile(filepath.Join(dir, path))
+		require.NoError(t, err, path)
+		require.Equal(t, "content of pkg/lib/libfoo.so.1", string(content), path)
+	}
+	link, err := os.Readlink(filepath.Join(dir, "lib", "libfoo.so"))
+	require.NoError(t, err)
+	require.Equal(t, "libfoo.so.1", link)
+}
+
+func TestUntarLinksEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on windows")
+	}
+	tests := map[string][]*tar.Header{
+		"absolute symlink": {
+			{Typeflag: tar.TypeSymlink, Name: "passwd", Linkname: "/etc/passwd"},
+		},
+		"relative symlink": {
+			{Typeflag: tar.TypeSymlink, Name: "lib/outside", Linkname: "../../outside"},
+		},
+		"dotdot after symlink": {
+			{Typeflag: tar.TypeSymlink, Name: "root", Linkname: "."},
+			{Typeflag: tar.TypeSymlink, Name: "sub/escape", Linkname: "../root/.."},
+		},
+		"write through symlink": {
+			{Typeflag: tar.TypeSymlink, Name: "sub", Linkname: "."},
+			{Typeflag: tar.TypeReg, Name: "sub/file.txt", Mode: 0644},
+		},
+		"hardlink outside": {
+			{Typeflag: tar.TypeLink, Name: "passwd", Linkname: "../etc/passwd"},
+		},
+		"hardlink absolute": {
+			{Typeflag: tar.TypeLink, Name: "passwd", Linkname: "/etc/passwd"},
+		},
+	}
+	for name, headers := range tests {
+		dir := filepath.Join(t.TempDir(), "dest")
+		err := untar.Untar(bytes.NewReader(makeTarEntries(t, headers)), dir, 0)
+		require.Error(t, err, name)
+	}
+}
+
+func TestUntarLimits(t *testing.T) {
+	archive := makeTarEntries(t, []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "pkg/", Mode: 0755},
+		{Typeflag: tar.TypeDir, Name: "pkg/a/", Mode: 0755},
+		{Typeflag: tar.TypeDir, Name: "pkg/a/b/", Mode: 0755},
+		{Typeflag: tar.TypeReg, Name: "pkg/a/b/file1.txt", Mode: 0644},
+		{Typeflag: tar.TypeReg, Name: "pkg/a/b/file2.txt", Mode: 0644},
+	})
+	// each file has 'content of pkg/a/b/fileN.txt', 28 bytes
+	tests := []struct {
+		opts  untar.Options
+		limit string
+	}{
+		{opts: untar.Options{MaxEntries: 4}, limit: "MaxEntries"},
+		{opts: untar.Options{MaxPathDepth: 3}, limit: "MaxPathDepth"},
+		{opts: untar.Options{MaxFileSize: 20}, limit: "MaxFileSize"},
+		{opts: untar.Options{MaxTotalSize: 40}, limit: "MaxTotalSize"},
+		{opts: untar.DefaultOptions()},
+		{opts: untar.Options{MaxEntries: 5, MaxPathDepth: 4, MaxFileSize: 28, MaxTotalSize: 56}},
+	}
+	for _, tt := range tests {
+		err := untar.UntarWithOptions(bytes.NewReader(archive), t.TempDir(), tt.opts)
+		if tt.limit == "" {
+			require.NoError(t, err)
+			continue
+		}
+		var limitErr *untar.LimitError
+		require.ErrorAs(t, err, &limitErr, tt.limit)
+		require.Equal(t, tt.limit, limitErr.Limit)
+	}
+}
@@ -0,0 +1,196 @@
+// Package unzip unzips a zip archive to disk.
+package unzip
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/machbase/neo-pkgdev/pkgs/archivepath"
+	"github.com/machbase/neo-pkgdev/pkgs/untar"
+)
+
+// UnzipFile extracts the zip file of the path into dir.
+func UnzipFile(path string, dir string, stripComponents int) error {
+	return UnzipFileWithOptions(path, dir, untar.Options{StripComponents: stripComponents})
+}
+
+// UnzipFileWithOptions is same as UnzipFile, but it enforces the limits of the opts while extracting.
+func UnzipFileWithOptions(path string, dir string, opts untar.Options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return UnzipWithOptions(f, stat.Size(), dir, opts)
+}
+
+// Unzip reads the zip archive from r and writes it into dir.
+// The leading stripComponents path elements of the entries are removed, like 'tar --strip-components'.
+func Unzip(r io.ReaderAt, size int64, dir string, stripComponents int) error {
+	return UnzipWithOptions(r, size, dir, untar.Options{StripComponents: stripComponents})
+}
+
+// UnzipWithOptions is same as Unzip, but it enforces the limits of the opts while extracting,
+// it returns the untar.LimitError if the archive exceeds one of them.
+func UnzipWithOptions(r io.ReaderAt, size int64, dir string, opts untar.Options) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("zip error: %v", err)
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	t0 := time.Now()
+	madeDir := map[string]bool{}
+	var totalSize int64
+	for i, f := range zr.File {
+		if !archivepath.ValidRelPath(f.Name) {
+			return fmt.Errorf("zip contained invalid name error %q", f.Name)
+		}
+		entrySize := int64(f.UncompressedSize64)
+		if f.UncompressedSize64 > math.MaxInt64 {
+			entrySize = math.MaxInt64
+		}
+		if err := opts.CheckEntry(f.Name, f.Mode().IsRegular(), entrySize, i+1, totalSize); err != nil {
+			return err
+		}
+		rel := archivepath.StripComponents(f.Name, opts.StripComponents)
+		if rel == "" || rel == "." {
+			continue
+		}
+		abs := filepath.Join(dir, rel)
+		if !archivepath.WithinDir(dir, abs) {
+			return fmt.Errorf("zip contained invalid name error %q", f.Name)
+		}
+		if err := archivepath.CheckNoSymlink(dir, abs); err != nil {
+			return err
+		}
+		mode := f.Mode()
+		switch {
+		case mode&os.ModeSymlink != 0:
+			if err := writeSymlink(f, dir, abs); err != nil {
+				return err
+			}
+		case mode.IsDir():
+			perm := mode.Perm()
+			if perm == 0 {
+				perm = 0755
+			}
+			if err := os.MkdirAll(abs, perm|0700); err != nil {
+				return err
+			}
+			madeDir[abs] = true
+		case mode.IsRegular():
+			parent := filepath.Dir(abs)
+			if !madeDir[parent] {
+				if err := os.MkdirAll(parent, 0755); err != nil {
+					return err
+				}
+				madeDir[parent] = true
+			}
+			if err := writeFile(f, abs, t0); err != nil {
+				return err
+			}
+			totalSize += entrySize
+		default:
+			return fmt.Errorf("zip file entry %s contained unsupported file type %v", f.Name, mode)
+		}
+	}
+	return nil
+}
+
+// maxLinkTarget is the max length of the target of a symlink entry, which is the content of the entry.
+const maxLinkTarget = 4096
+
+// writeSymlink makes the symlink of the entry, whose target has to resolve in the dir like untar.
+func writeSymlink(f *zip.File, dir string, abs string) error {
+	if f.UncompressedSize64 > maxLinkTarget {
+		return fmt.Errorf("zip contained invalid symlink %q", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	target, err := io.ReadAll(io.LimitReader(rc, maxLinkTarget))
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	linkname := string(target)
+	if !archivepath.ValidLinkTarget(dir, abs, linkname) {
+		return fmt.Errorf("zip contained invalid symlink %q -> %q", f.Name, linkname)
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(abs); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(linkname), abs)
+}
+
+func writeFile(f *zip.File, abs string, t0 time.Time) error {
+	if fi, err := os.Lstat(abs); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		// never write through the symlink
+		if err := os.Remove(abs); err != nil {
+			return err
+		}
+	}
+	perm := f.Mode().Perm()
+	if perm == 0 {
+		// the archive made on Windows has no unix permissions
+		perm = 0644
+	}
+	if runtime.GOOS == "darwin" && perm&0111 != 0 {
+		// The darwin kernel caches binary signatures and SIGKILLs binaries
+		// with mismatched signatures. Removing the original file first
+		// clears the cache, see untar.
+		if err := os.Remove(abs); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	wf, err := os.OpenFile(abs, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(wf, rc)
+	if closeErr := wf.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing to %s: %v", abs, err)
+	}
+	if uint64(n) != f.UncompressedSize64 {
+		return fmt.Errorf("only wrote %d bytes to %s; expected %d", n, abs, f.UncompressedSize64)
+	}
+	// the umask may have dropped some bits of the permission
+	if err := os.Chmod(abs, perm); err != nil {
+		return err
+	}
+	modTime := f.Modified
+	if modTime.After(t0) {
+		modTime = t0
+	}
+	if !modTime.IsZero() {
+		os.Chtimes(abs, modTime, modTime)
+	}
+	return nil
+}
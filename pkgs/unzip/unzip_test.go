@@ -0,0 +1,167 @@
+package unzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/machbase/neo-pkgdev/pkgs/untar"
+	"github.com/machbase/neo-pkgdev/pkgs/unzip"
+	"github.com/stretchr/testify/require"
+)
+
+type entry struct {
+	name    string
+	mode    os.FileMode
+	content string
+}
+
+func makeZip(t *testing.T, entries []entry) *bytes.Reader {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, ent := range entries {
+		hdr := &zip.FileHeader{Name: ent.name, Method: zip.Deflate}
+		hdr.SetMode(ent.mode)
+		w, err := zw.CreateHeader(hdr)
+		require.NoError(t, err)
+		if !ent.mode.IsDir() {
+			_, err = w.Write([]byte(ent.content))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, zw.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestUnzip(t *testing.T) {
+	r := makeZip(t, []entry{
+		{name: "build/", mode: os.ModeDir | 0755},
+		{name: "build/index.html", mode: 0644, content: "<html></html>"},
+		{name: "build/bin/", mode: os.ModeDir | 0755},
+		{name: "build/bin/run.sh", mode: 0755, content: "#!/bin/sh\necho hello\n"},
+	})
+	dir := t.TempDir()
+	require.NoError(t, unzip.Unzip(r, r.Size(), dir, 1))
+
+	content, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	require.Equal(t, "<html></html>", string(content))
+
+	stat, err := os.Stat(filepath.Join(dir, "bin", "run.sh"))
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		require.Equal(t, os.FileMode(0755), stat.Mode().Perm())
+	}
+	_, err = os.Stat(filepath.Join(dir, "build"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestUnzipSlip(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "build/../../evil.txt", "/etc/evil.txt", `build\..\evil.txt`} {
+		r := makeZip(t, []entry{{name: name, mode: 0644, content: "evil"}})
+		dir := t.TempDir()
+		err := unzip.Unzip(r, r.Size(), filepath.Join(dir, "dest"), 0)
+		require.Error(t, err, name)
+		_, err = os.Stat(filepath.Join(dir, "evil.txt"))
+		require.True(t, os.IsNotExist(err), name)
+	}
+}
+
+func TestUnzipStripKeepsTopLevelFiles(t *testing.T) {
+	r := makeZip(t, []entry{
+		{name: "README.md", mode: 0644, content: "readme"},
+		{name: "build/", mode: os.ModeDir | 0755},
+		{name: "build/index.html", mode: 0644, content: "<html></html>"},
+	})
+	dir := t.TempDir()
+	require.NoError(t, unzip.Unzip(r, r.Size(), dir, 1))
+	// same as untar, the entries which have no more elements to strip are kept
+	for _, name := range []string{"README.md", "index.html"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		require.NoError(t, err, name)
+	}
+}
+
+func TestUnzipSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on windows")
+	}
+	r := makeZip(t, []entry{
+		{name: "pkg/lib/", mode: os.ModeDir | 0755},
+		{name: "pkg/lib/libfoo.so.1", mode: 0644, content: "libfoo"},
+		{name: "pkg/lib/libfoo.so", mode: os.ModeSymlink | 0777, content: "libfoo.so.1"},
+		{name: "pkg/bin/lib", mode: os.ModeSymlink | 0777, content: "../lib"},
+	})
+	dir := t.TempDir()
+	require.NoError(t, unzip.Unzip(r, r.Size(), dir, 1))
+	for _, path := range []string{"lib/libfoo.so", "bin/lib/libfoo.so.1"} {
+		content, err := os.ReadFile(filepath.Join(dir, path))
+		require.NoError(t, err, path)
+		require.Equal(t, "libfoo", string(content), path)
+	}
+	link, err := os.Readlink(filepath.Join(dir, "lib", "libfoo.so"))
+	require.NoError(t, err)
+	require.Equal(t, "libfoo.so.1", link)
+}
+
+func TestUnzipSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on windows")
+	}
+	tests := map[string][]entry{
+		"absolute symlink": {
+			{name: "passwd", mode: os.ModeSymlink | 0777, content: "/etc/passwd"},
+		},
+		"relative symlink": {
+			{name: "lib/outside", mode: os.ModeSymlink | 0777, content: "../../outside"},
+		},
+		"dotdot after symlink": {
+			{name: "root", mode: os.ModeSymlink | 0777, content: "."},
+			{name: "sub/escape", mode: os.ModeSymlink | 0777, content: "../root/.."},
+		},
+		"write through symlink": {
+			{name: "sub", mode: os.ModeSymlink | 0777, content: "."},
+			{name: "sub/file.txt", mode: 0644, content: "evil"},
+		},
+	}
+	for name, entries := range tests {
+		r := makeZip(t, entries)
+		err := unzip.Unzip(r, r.Size(), filepath.Join(t.TempDir(), "dest"), 0)
+		require.Error(t, err, name)
+	}
+}
+
+func TestUnzipLimits(t *testing.T) {
+	r := makeZip(t, []entry{
+		{name: "pkg/", mode: os.ModeDir | 0755},
+		{name: "pkg/a/", mode: os.ModeDir | 0755},
+		{name: "pkg/a/b/", mode: os.ModeDir | 0755},
+		{name: "pkg/a/b/file1.txt", mode: 0644, content: "0123456789"},
+		{name: "pkg/a/b/file2.txt", mode: 0644, content: "0123456789"},
+	})
+	tests := []struct {
+		opts  untar.Options
+		limit string
+	}{
+		{opts: untar.Options{MaxEntries: 4}, limit: "MaxEntries"},
+		{opts: untar.Options{MaxPathDepth: 3}, limit: "MaxPathDepth"},
+		{opts: untar.Options{MaxFileSize: 9}, limit: "MaxFileSize"},
+		{opts: untar.Options{MaxTotalSize: 15}, limit: "MaxTotalSize"},
+		{opts: untar.DefaultOptions()},
+		{opts: untar.Options{MaxEntries: 5, MaxPathDepth: 4, MaxFileSize: 10, MaxTotalSize: 20}},
+	}
+	for _, tt := range tests {
+		err := unzip.UnzipWithOptions(r, r.Size(), t.TempDir(), tt.opts)
+		if tt.limit == "" {
+			require.NoError(t, err)
+			continue
+		}
+		var limitErr *untar.LimitError
+		require.ErrorAs(t, err, &limitErr, tt.limit)
+		require.Equal(t, tt.limit, limitErr.Limit)
+	}
+}
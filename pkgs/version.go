@@ -0,0 +1,102 @@
+package pkgs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// versionInName finds the version in the name of the version directory of the direct url distribution,
+// e.g. 'mytool-1.2.3' or 'mytool_v1.2.3-rc1-linux-amd64'.
+var versionInName = regexp.MustCompile(`(?:^|[-_])v?(\d+(?:\.\d+){1,2}(?:-(?:alpha|beta|rc|pre)[0-9A-Za-z.]*)?)`)
+
+// revisionSuffix is the package revision at the end of the version, e.g. '1.2.3-r2'.
+var revisionSuffix = regexp.MustCompile(`-r(\d+)$`)
+
+// revisionInName is the package revision which follows the version in the name of the version directory,
+// e.g. 'mytool-1.2.3-r2-linux-amd64'.
+var revisionInName = regexp.MustCompile(`(?:^|[-_])v?\d+(?:\.\d+){1,2}(?:-(?:alpha|beta|rc|pre)[0-9A-Za-z.]*)?(-r(\d+))(?:[-_.]|$)`)
+
+// RevisionVersion returns the version with the package revision, e.g. '1.2.3-r2',
+// it returns the version as it is if the revision is 0.
+func RevisionVersion(version string, revision int) string {
+	if revision <= 0 {
+		return version
+	}
+	return fmt.Sprintf("%s-r%d", version, revision)
+}
+
+// RevisionName returns the name of the version directory of the direct url distribution with the package revision.
+// The revision follows the version in the name, e.g. 'mytool-1.2.3-r2-linux-amd64',
+// and the version with the revision is appended if the name has no version, e.g. 'mytool-1.2.3-r2'.
+// It returns the name as it is if the revision is 0.
+func RevisionName(name string, version string, revision int) string {
+	if revision <= 0 {
+		return name
+	}
+	if loc := versionInName.FindStringSubmatchIndex(name); loc != nil {
+		return fmt.Sprintf("%s-r%d%s", name[:loc[3]], revision, name[loc[3]:])
+	}
+	return fmt.Sprintf("%s-%s", name, RevisionVersion(version, revision))
+}
+
+// SplitRevision splits the version into the upstream version and the package revision,
+// e.g. '1.2.3-r2' into '1.2.3' and 2, or 'mytool-1.2.3-r2-linux-amd64' into 'mytool-1.2.3-linux-amd64' and 2.
+// The revision is 0 if the version has no revision.
+func SplitRevision(version string) (string, int) {
+	if m := revisionSuffix.FindStringSubmatch(version); m != nil {
+		if rev, err := strconv.Atoi(m[1]); err == nil {
+			return strings.TrimSuffix(version, m[0]), rev
+		}
+		return version, 0
+	}
+	if loc := revisionInName.FindStringSubmatchIndex(version); loc != nil {
+		if rev, err := strconv.Atoi(version[loc[4]:loc[5]]); err == nil {
+			return version[:loc[2]] + version[loc[3]:], rev
+		}
+	}
+	return version, 0
+}
+
+// ParseVersion parses the version of the package, which is the name of the version directory.
+// It falls back to the version in the name if the whole name is not a semantic version.
+func ParseVersion(version string) (*semver.Version, error) {
+	if v, err := semver.NewVersion(version); err == nil {
+		return v, nil
+	}
+	if m := versionInName.FindStringSubmatch(version); m != nil {
+		if v, err := semver.NewVersion(m[1]); err == nil {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid version %q", version)
+}
+
+// CompareVersions returns -1 if a is older than b, 1 if a is newer than b, 0 if they are the same version
+// in the sense of semantic versioning, e.g. 'v1.2' and '1.2.0' are the same.
+// The package revisions are compared if the upstream versions are the same, e.g. '1.2.3-r2' is newer than '1.2.3'.
+func CompareVersions(a, b string) (int, error) {
+	a, revA := SplitRevision(a)
+	b, revB := SplitRevision(b)
+	va, err := ParseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := ParseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	if cmp := va.Compare(vb); cmp != 0 {
+		return cmp, nil
+	}
+	switch {
+	case revA < revB:
+		return -1, nil
+	case revA > revB:
+		return 1, nil
+	}
+	return 0, nil
+}
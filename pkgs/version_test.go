@@ -0,0 +1,154 @@
+package pkgs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b   string
+		expect int
+	}{
+		{"1.0.0", "1.0.1", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"v1.2", "1.2.0", 0},
+		{"1.0.0-rc1", "1.0.0", -1},
+		{"mytool-1.2.3", "1.2.3", 0},
+		{"mytool_v1.2.3-linux-amd64", "1.2.4", -1},
+		{"mytool-2.0.0-beta.1", "2.0.0-beta.2", -1},
+	} {
+		cmp, err := CompareVersions(tc.a, tc.b)
+		require.NoError(t, err, "%s %s", tc.a, tc.b)
+		require.Equal(t, tc.expect, cmp, "%s %s", tc.a, tc.b)
+	}
+	_, err := CompareVersions("latest", "1.0.0")
+	require.Error(t, err)
+}
+
+func TestRevisionVersion(t *testing.T) {
+	require.Equal(t, "1.2.3", RevisionVersion("1.2.3", 0))
+	require.Equal(t, "1.2.3-r2", RevisionVersion("1.2.3", 2))
+	ver, rev := SplitRevision("1.2.3-r2")
+	require.Equal(t, "1.2.3", ver)
+	require.Equal(t, 2, rev)
+	ver, rev = SplitRevision("1.2.3-rc1")
+	require.Equal(t, "1.2.3-rc1", ver)
+	require.Equal(t, 0, rev)
+
+	// the revision of the version directory of the direct url distribution follows the version
+	for _, tc := range []struct {
+		name, expect string
+	}{
+		{"mytool-1.2.3", "mytool-1.2.3-r2"},
+		{"mytool_v1.2.3-linux-amd64", "mytool_v1.2.3-r2-linux-amd64"},
+		{"mytool-1.2.3-rc1-linux", "mytool-1.2.3-rc1-r2-linux"},
+		{"1.2.3", "1.2.3-r2"},
+	} {
+		name := RevisionName(tc.name, "1.2.3", 2)
+		require.Equal(t, tc.expect, name)
+		ver, rev := SplitRevision(name)
+		require.Equal(t, tc.name, ver)
+		require.Equal(t, 2, rev)
+		cmp, err := CompareVersions(tc.name, name)
+		require.NoError(t, err, name)
+		require.Equal(t, -1, cmp, name)
+	}
+	// the name without the version gets the version
+	require.Equal(t, "mytool-1.2.3-r2", RevisionName("mytool", "1.2.3", 2))
+	require.Equal(t, "mytool-1.2.3", RevisionName("mytool-1.2.3", "1.2.3", 0))
+
+	for _, tc := range []struct {
+		a, b   string
+		expect int
+	}{
+		{"1.2.3", "1.2.3-r1", -1},
+		{"1.2.3-r2", "1.2.3-r10", -1},
+		{"1.2.3-r2", "1.2.4", -1},
+		{"1.2.3-r2", "1.2.3-rc1", 1},
+		{"mytool-1.2.3-r2", "1.2.3-r2", 0},
+	} {
+		cmp, err := CompareVersions(tc.a, tc.b)
+		require.NoError(t, err, "%s %s", tc.a, tc.b)
+		require.Equal(t, tc.expect, cmp, "%s %s", tc.a, tc.b)
+	}
+	hold := &PackageHold{Constraint: "~1.2"}
+	require.True(t, hold.Allows("1.2.3-r2"))
+	hold = &PackageHold{Version: "1.2.3"}
+	require.False(t, hold.Allows("1.2.3-r2"))
+}
+
+func TestRevision(t *testing.T) {
+	roster, _ := newTestRoster(t, nil)
+	writeTestPackage(t, roster.baseDir, ROSTER_CENTRAL, "echo", "")
+	files := map[string][]byte{}
+	for _, ver := range []string{"1.0.0", "1.0.0-r1"} {
+		archive := makeTarGz(t, map[string]string{"index.html": ver})
+		sum := sha256.Sum256(archive)
+		files["machbase/echo/echo-"+ver+".tar.gz"] = archive
+		files["machbase/echo/echo-"+ver+".tar.gz.sum"] = []byte(hex.EncodeToString(sum[:]))
+	}
+	store := newTestArtifactStore(t, roster, files)
+
+	inst := installTestPackage(t, roster, "echo")
+	require.Equal(t, "1.0.0", inst.Version)
+
+	// the recipe is fixed, and the artifact is rebuilt
+	cache, err := roster.LoadPackageCache("echo")
+	require.NoError(t, err)
+	cache.Revision = 1
+	require.NoError(t, roster.WritePackageCache(cache))
+	cache, err = roster.LoadPackageCache("echo")
+	require.NoError(t, err)
+	require.Equal(t, "1.0.0-r1", cache.Version())
+	dist, err := cache.RemoteDistribution()
+	require.NoError(t, err)
+	require.Equal(t, store.URL+"/machbase/echo/echo-1.0.0-r1.tar.gz", dist[0].Url)
+
+	upgradable, _, err := roster.upgradables()
+	require.NoError(t, err)
+	require.Len(t, upgradable, 1)
+	require.Equal(t, "1.0.0-r1", upgradable[0].LatestRelease)
+
+	inst = installTestPackage(t, roster, "echo")
+	require.Equal(t, "1.0.0-r1", inst.Version)
+	content, err := os.ReadFile(filepath.Join(inst.CurrentPath, "index.html"))
+	require.NoError(t, err)
+	require.Equal(t, "1.0.0-r1", string(content))
+	upgradable, _, err = roster.upgradables()
+	require.NoError(t, err)
+	require.Empty(t, upgradable)
+}
+
+func TestRevisionDirectUrl(t *testing.T) {
+	roster, _ := newTestRoster(t, map[string][]byte{
+		"mytool-1.2.3-linux-amd64.tar.gz": makeTarGz(t, map[string]string{"index.html": "mytool"}),
+	})
+	setTestLatest(t, roster, "mytool", "1.2.3")
+	inst := installTestPackage(t, roster, "mytool")
+	require.Equal(t, "mytool-1.2.3-linux-amd64", inst.Version)
+	upgradable, _, err := roster.upgradables()
+	require.NoError(t, err)
+	require.Empty(t, upgradable)
+
+	// the recipe is fixed, the same upstream archive is installed again as the revision
+	cache, err := roster.LoadPackageCache("mytool")
+	require.NoError(t, err)
+	cache.Revision = 1
+	require.NoError(t, roster.WritePackageCache(cache))
+	upgradable, _, err = roster.upgradables()
+	require.NoError(t, err)
+	require.Len(t, upgradable, 1)
+	require.Equal(t, "1.2.3-r1", upgradable[0].LatestRelease)
+
+	inst = installTestPackage(t, roster, "mytool")
+	require.Equal(t, "mytool-1.2.3-r1-linux-amd64", inst.Version)
+	upgradable, _, err = roster.upgradables()
+	require.NoError(t, err)
+	require.Empty(t, upgradable)
+}
@@ -0,0 +1,80 @@
+package pkgs
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// DEFAULT_WORK_TIMEOUT is the default age after which the work-in-progress marker is stale
+// even if its process looks alive.
+const DEFAULT_WORK_TIMEOUT = time.Hour
+
+// WorkMarker is the content of the 'wip' file in the package dir,
+// it is written while the package is being installed.
+type WorkMarker struct {
+	Pid       int          `json:"pid"`
+	Hostname  string       `json:"hostname"`
+	StartedAt time.Time    `json:"started_at"`
+	Phase     InstallPhase `json:"phase"`
+	Url       string       `json:"url"`
+}
+
+func newWorkMarker(url string) *WorkMarker {
+	hostname, _ := os.Hostname()
+	return &WorkMarker{
+		Pid:       os.Getpid(),
+		Hostname:  hostname,
+		StartedAt: time.Now(),
+		Phase:     PHASE_RESOLVE,
+		Url:       url,
+	}
+}
+
+func WriteWorkMarker(path string, m *WorkMarker) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// ReadWorkMarker reads the 'wip' file.
+// The old versions wrote only the download url into the file,
+// for which it returns the marker with the url and the modification time of the file.
+func ReadWorkMarker(path string) (*WorkMarker, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := &WorkMarker{}
+	if err := json.Unmarshal(content, ret); err != nil {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		ret = &WorkMarker{Url: string(content), StartedAt: stat.ModTime()}
+	}
+	return ret, nil
+}
+
+// Age returns how long the work has been in progress.
+func (m *WorkMarker) Age() time.Duration {
+	return time.Since(m.StartedAt)
+}
+
+// Stale reports whether the work is abandoned, that is the process which wrote the marker
+// is gone or the timeout has passed. A timeout <= 0 means no timeout.
+// The process of the other host can not be checked, so only the timeout applies to it.
+func (m *WorkMarker) Stale(timeout time.Duration) bool {
+	if timeout > 0 && m.Age() > timeout {
+		return true
+	}
+	if m.Pid <= 0 {
+		return false
+	}
+	if hostname, err := os.Hostname(); err != nil || hostname != m.Hostname {
+		return false
+	}
+	return !processAlive(m.Pid)
+}
@@ -0,0 +1,59 @@
+package pkgs
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// syncWriter serializes writes from multiple goroutines.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.w == nil {
+		return len(p), nil
+	}
+	return sw.w.Write(p)
+}
+
+// prefixWriter writes each line with the prefix.
+// The last incomplete line is kept until the next Write or Flush.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	buf    []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	for {
+		idx := bytes.IndexByte(pw.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		line := make([]byte, 0, len(pw.prefix)+idx+1)
+		line = append(line, pw.prefix...)
+		line = append(line, pw.buf[:idx+1]...)
+		pw.buf = pw.buf[idx+1:]
+		if _, err := pw.w.Write(line); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+func (pw *prefixWriter) Flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	line := append([]byte(pw.prefix), pw.buf...)
+	line = append(line, '\n')
+	pw.buf = pw.buf[:0]
+	_, err := pw.w.Write(line)
+	return err
+}